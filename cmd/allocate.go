@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"sync"
+	"time"
+
+	sdk "agones.dev/agones/sdks/go"
+	"github.com/go-co-op/gocron"
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/ping"
+)
+
+// Allocates Ready servers once players join and reserves them during maintenance windows
+type allocator struct {
+	cfg   config.MonitorConfig
+	sdk   *sdk.SDK
+	state *gameServerState
+
+	mu     sync.Mutex
+	online int32
+}
+
+// Schedules the maintenance windows of MAINTENANCE_CRON. state is the watched state of the GameServer
+func newAllocator(cfg config.MonitorConfig, s *sdk.SDK, state *gameServerState) (*allocator, error) {
+	a := &allocator{cfg: cfg, sdk: s, state: state}
+
+	if cron := cfg.GetMaintenanceCron(); cron != "" {
+		scheduler := gocron.NewScheduler(time.UTC)
+		if _, err := scheduler.Cron(cron).Do(a.reserve); err != nil {
+			return nil, err
+		}
+		scheduler.StartAsync()
+	}
+
+	return a, nil
+}
+
+// Records the player count of a ping. With AUTO_ALLOCATE, a Ready server is allocated once a player is online, so
+// it no longer counts as spare capacity of the fleet
+func (a *allocator) Observe(info *ping.ServerInfo) {
+	a.mu.Lock()
+	a.online = info.OnlinePlayers
+	a.mu.Unlock()
+
+	if !a.cfg.GetAutoAllocate() || info.OnlinePlayers == 0 || a.state.Get() != readyState {
+		return
+	}
+
+	if err := a.sdk.Allocate(); err != nil {
+		logger.Error("error allocating server", zap.Error(err))
+		return
+	}
+
+	logger.Info("players joined. server allocated", zap.Int32("onlinePlayers", info.OnlinePlayers))
+}
+
+// Reserves the server for MAINTENANCE_DURATION, so it is neither allocated nor scaled down. Servers that are
+// allocated or have players online are left alone
+func (a *allocator) reserve() {
+	a.mu.Lock()
+	online := a.online
+	a.mu.Unlock()
+
+	if state := a.state.Get(); state != readyState || online > 0 {
+		logger.Info("skipping maintenance window. server in use", zap.String("state", state), zap.Int32("onlinePlayers", online))
+		return
+	}
+
+	if err := a.sdk.Reserve(a.cfg.GetMaintenanceDuration()); err != nil {
+		logger.Error("error reserving server for maintenance", zap.Error(err))
+		return
+	}
+
+	logger.Info("server reserved for maintenance", zap.Duration("duration", a.cfg.GetMaintenanceDuration()))
+}
@@ -3,29 +3,35 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"net"
+	"io"
 	"os"
 	"path"
-	"strconv"
 	"time"
 
 	"github.com/go-co-op/gocron"
-	"github.com/james4k/rcon"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
 	"github.com/raefon/agones-mc/internal/config"
 	"github.com/raefon/agones-mc/pkg/backup"
-	"github.com/raefon/agones-mc/pkg/backup/google"
+	"github.com/raefon/agones-mc/pkg/backup/incremental"
+	"github.com/raefon/agones-mc/pkg/hooks"
+	"github.com/raefon/agones-mc/pkg/metrics"
+	"github.com/raefon/agones-mc/pkg/rcon"
 	"github.com/raefon/agones-mc/pkg/signal"
 )
 
+// Prefix of the server message sent once save-all has written the world to disk
+const saveCompleteMsg = "Saved the"
+
 var backupCmd = cobra.Command{
 	Use:   "backup",
 	Short: "Saves and backsup minecraft world",
 	Long:  "backup is for saving and backup up current minecraft world",
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := config.NewBackupConfig()
+		metrics.RegisterBackup()
 
 		dur := cfg.GetInitialDelay()
 		if dur > 0 {
@@ -33,27 +39,54 @@ var backupCmd = cobra.Command{
 			time.Sleep(dur)
 		}
 
-		if cron := cfg.GetBackupCron(); cron != "" {
+		status := newBackupStatus(cfg)
+
+		if cron := cfg.GetBackupCron(); cron != "" || hasEventTriggers(cfg) {
 			stop := signal.SetupSignalHandler(logger)
 
+			ctx, cancel := context.WithCancel(context.Background())
+			runner := newBackupRunner(cfg, status)
+			serveMetrics(ctx, cfg.GetMetricsAddr())
+
+			done := make(chan struct{})
+			go func() {
+				runner.Run(ctx)
+				close(done)
+			}()
+
 			s := gocron.NewScheduler(time.UTC)
 
-			s.Cron(cron).Do(func() {
-				if err := RunBackup(cfg); err != nil {
-					logger.Error("backup failed", zap.String("serverName", cfg.GetPodName()), zap.Error(err))
-				} else {
-					logger.Info("backup successful", zap.String("serverName", cfg.GetPodName()))
-				}
-			})
+			if cron != "" {
+				s.Cron(cron).Do(func() {
+					runner.Trigger(cronTrigger)
+				})
+			}
+
+			if err := startTriggers(ctx, cfg, runner); err != nil {
+				logger.Fatal("error starting backup triggers", zap.Error(err))
+			}
 
 			s.StartAsync()
 			<-stop // SIGTERM
 			s.Clear()
 			s.Stop()
+
+			// wait for a running backup
+			cancel()
+			<-done
+
+			// the world was already backed up when the GameServer shut down
+			if runner.Last() == shutdownTrigger {
+				logger.Info("skipping final backup. backed up on shutdown", zap.String("serverName", cfg.GetPodName()))
+				return
+			}
+
 			// attempt a final backup before terminating
 		}
 
-		if err := RunBackup(cfg); err != nil {
+		result, err := RunBackup(cfg)
+		status.Publish(result, err)
+		if err != nil {
 			logger.Fatal("backup failed", zap.String("serverName", cfg.GetPodName()))
 		}
 
@@ -63,88 +96,346 @@ var backupCmd = cobra.Command{
 }
 
 func init() {
+	backupCmd.Flags().Bool("dry-run", config.RETENTION_DRY_RUN_DEFAULT, "log backups that would be pruned by the retention policy without deleting them")
+	viper.BindPFlag(config.RETENTION_DRY_RUN, backupCmd.Flags().Lookup("dry-run"))
+
 	RootCmd.AddCommand(&backupCmd)
 }
 
-func RunBackup(cfg config.BackupConfig) error {
-	// Run save-all on minecraft server to force save-all before backup
-	if err := saveAll(cfg.GetHost(), cfg.GetPort(), cfg.GetRCONPassword()); err != nil {
-		logger.Warn("error saving world. skipping save-all", zap.Error(err))
+// Runs the pre-backup hooks, backs up the selected files, prunes old backups and runs the post-backup hooks.
+// Returns the name and size of the new backup
+func RunBackup(cfg config.BackupConfig) (backupResult, error) {
+	cfgHooks, err := readHooks(cfg)
+	if err != nil {
+		logger.Error("invalid backup hooks", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	opts := hooks.Options{Host: cfg.GetHost(), RCONPort: cfg.GetRCONPort(), RCONPassword: cfg.GetRCONPassword()}
+	ignored := func(h hooks.Hook, err error) {
+		logger.Warn("backup hook failed", zap.String("hook", h.Name), zap.Error(err))
 	}
 
-	// Authenticate and create Google Cloud Storage client
-	cloudStorageClient, err := google.New(context.Background(), cfg.GetBucketName())
+	start := time.Now()
+	vars := hooks.Vars{Phase: "pre", Server: cfg.GetPodName()}
+
+	var result backupResult
+	err = hooks.Run(cfgHooks.Pre, vars, opts, ignored)
+	if err != nil {
+		logger.Error("pre-backup hook failed. aborting backup", zap.Error(err))
+	} else {
+		result, err = runBackup(cfg)
+	}
+
+	// post-backup hooks also run after a failed backup, e.g. to report it or undo a pre-backup hook
+	vars.Phase = "post"
+	vars.Name = result.Name
+	vars.Size = result.Size
+	vars.Duration = hooks.Duration(time.Since(start))
+	vars.Status = backupSucceeded
+	if err != nil {
+		vars.Status = backupFailed
+		vars.Error = err.Error()
+	}
+
+	// the backup is already stored, so a failing post hook doesn't change its result
+	if herr := hooks.Run(cfgHooks.Post, vars, opts, ignored); herr != nil {
+		logger.Error("post-backup hook failed", zap.Error(herr))
+	}
+
+	metrics.ObserveBackup(time.Since(start), result.Size, err)
+	return result, err
+}
+
+// Parses the hooks in BACKUP_HOOKS, or BACKUP_HOOKS_FILE if it is set
+func readHooks(cfg config.BackupConfig) (*hooks.Config, error) {
+	data := []byte(cfg.GetBackupHooks())
+
+	if file := cfg.GetBackupHooksFile(); file != "" {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(data) == 0 {
+		return &hooks.Config{}, nil
+	}
+
+	return hooks.Parse(data)
+}
+
+// Backs up the selected files and prunes old backups
+func runBackup(cfg config.BackupConfig) (backupResult, error) {
+	// Authenticate and create storage client for the configured backend
+	storageClient, err := newBackupClient(context.Background(), cfg)
 	if err != nil {
 		logger.Error("error connecting to bucket", zap.Error(err))
-		return err
+		return backupResult{}, err
+	}
+
+	defer storageClient.Close()
+
+	// Select world dimensions and server files to back up
+	paths, err := backup.Select(cfg.GetVolume(), cfg.GetBackupInclude(), cfg.GetBackupExclude())
+	if err != nil {
+		logger.Error("error selecting files to back up", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	if len(paths) == 0 {
+		return backupResult{}, fmt.Errorf("no files in %s match %v", cfg.GetVolume(), cfg.GetBackupInclude())
 	}
 
-	defer cloudStorageClient.Close()
+	prefix := cfg.GetPodName() + "-"
 
-	backupName := fmt.Sprintf("%s-%v.zip", cfg.GetPodName(), time.Now().Format(time.RFC3339))
+	var result backupResult
+	if cfg.GetBackupMode() == config.IncrementalBackup {
+		if result, err = runIncrementalBackup(storageClient, cfg, paths); err != nil {
+			return result, err
+		}
 
-	var worldPath string
-	if cfg.GetEdition() == config.JavaEdition {
-		worldPath = path.Join(cfg.GetVolume(), "worlds", "Bedrock level")
+		prefix = incremental.SnapshotPrefix + prefix
 	} else {
-		worldPath = path.Join(cfg.GetVolume(), "world")
+		if result, err = runFullBackup(storageClient, cfg, paths); err != nil {
+			return result, err
+		}
 	}
 
-	// Create zip backup
-	err = backup.Zipit(worldPath, backupName)
-	if err != nil {
-		logger.Error("error creating zip backup", zap.Error(err))
-		return err
+	// Prune old backups. The new backup is already uploaded so a failed prune does not fail the backup
+	if err := pruneBackups(storageClient, cfg, prefix); err != nil {
+		logger.Warn("error pruning old backups", zap.Error(err))
 	}
 
-	file, err := os.Open(backupName)
+	return result, nil
+}
+
+// Name, time and size of a stored backup. The size of incremental snapshots is the total size of their files
+type backupResult struct {
+	Name    string
+	Created time.Time
+	Size    int64
+}
+
+// Archives the selected paths in the configured format and uploads it. The archive is streamed to storage as it is written
+// unless spooling is enabled or the backend needs the size up front, in which case it is written to a temp file first
+func runFullBackup(client backup.BackupClient, cfg config.BackupConfig, paths []string) (backupResult, error) {
+	format, err := backup.ParseFormat(cfg.GetArchiveFormat())
 	if err != nil {
-		logger.Error("error creating zip backup", zap.Error(err))
-		return err
+		return backupResult{}, err
 	}
 
-	defer file.Close()
+	now := time.Now()
+	backupName := backup.Name(cfg.GetPodName(), now, format.Ext())
+	opts := backup.UploadOptions{ContentType: format.ContentType()}
 
-	// Backup to Google Cloud Storage
-	if err := cloudStorageClient.Backup(file); err != nil {
-		logger.Error("error backup up to bucket", zap.Error(err))
-		return err
+	var files []backup.File
+	digest := backup.NewDigest()
+
+	// Create archive while automatic saving is paused
+	write := func(w io.Writer) error {
+		return withSavingPaused(cfg, func() error {
+			var err error
+			files, err = backup.Archive(cfg.GetVolume(), paths, io.MultiWriter(w, digest), format, cfg.GetCompressionLevel())
+			return err
+		})
 	}
 
-	os.Remove(backupName)
+	if cfg.GetBackupSpool() || backup.RequiresContentLength(client) {
+		err = backup.Spool(client, backupName, opts, ".", write)
+	} else {
+		err = backup.Stream(client, backupName, opts, write)
+	}
 
-	return nil
+	if err != nil {
+		logger.Error("error backing up to bucket", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	// Upload the integrity manifest once the archive is stored
+	manifest := backup.NewManifest(backupName, format, files, digest)
+	manifest.Server = cfg.GetPodName()
+	manifest.Edition = string(cfg.GetEdition())
+	manifest.ServerVersion = serverVersion(cfg)
+	manifest.Created = now
+
+	if err := backup.UploadManifest(client, manifest); err != nil {
+		logger.Error("error uploading backup manifest", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	logger.Info("uploaded backup", zap.String("backupName", backupName), zap.Int("files", len(files)), zap.Int64("size", manifest.ArchiveSize))
+	return backupResult{backupName, now, manifest.ArchiveSize}, nil
 }
 
-func saveAll(host string, port int, password string) error {
-	if password == "" {
-		return fmt.Errorf("password env var is empty")
+// Chunks the selected paths and uploads the chunks that are not in storage yet, followed by the snapshot manifest
+func runIncrementalBackup(client backup.BackupClient, cfg config.BackupConfig, paths []string) (backupResult, error) {
+	now := time.Now()
+	snapshotName := incremental.SnapshotName(cfg.GetPodName(), now)
+
+	// Keep backups gc from deleting the stored blobs the snapshot reuses until its manifest is uploaded
+	release, err := incremental.Lease(client, cfg.GetPodName(), now)
+	if err != nil {
+		logger.Error("error creating snapshot lease", zap.Error(err))
+		return backupResult{}, err
 	}
 
-	hostport := net.JoinHostPort(host, strconv.Itoa(port))
+	defer func() {
+		if err := release(); err != nil {
+			logger.Warn("error releasing snapshot lease", zap.Error(err))
+		}
+	}()
 
-	rc, err := rcon.Dial(hostport, password)
+	known, err := incremental.ListBlobs(client)
 	if err != nil {
+		logger.Error("error listing stored blobs", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	// New chunks are uploaded as they are read, so saving stays paused until they are all stored. With spooling
+	// they are staged in the working directory instead and uploaded after saving is resumed
+	put := incremental.UploadBlobs(client)
+	stageDir := ""
+	if cfg.GetBackupSpool() {
+		if stageDir, err = os.MkdirTemp(".", "stage-"); err != nil {
+			return backupResult{}, err
+		}
+
+		defer os.RemoveAll(stageDir)
+		put = incremental.StageBlobs(stageDir)
+	}
+
+	var manifest *incremental.Manifest
+	err = withSavingPaused(cfg, func() error {
+		manifest, err = incremental.Snapshot(cfg.GetVolume(), paths, known, put, incremental.DefaultChunkSize)
 		return err
+	})
+	if err != nil {
+		logger.Error("error creating incremental snapshot", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	if stageDir != "" {
+		if err := incremental.UploadStaged(client, stageDir); err != nil {
+			logger.Error("error uploading incremental snapshot", zap.Error(err))
+			return backupResult{}, err
+		}
+	}
+
+	manifest.Server = cfg.GetPodName()
+	manifest.Edition = string(cfg.GetEdition())
+	manifest.ServerVersion = serverVersion(cfg)
+	manifest.Created = now
+
+	if err := incremental.UploadManifest(client, manifest, snapshotName); err != nil {
+		logger.Error("error uploading incremental snapshot", zap.Error(err))
+		return backupResult{}, err
+	}
+
+	logger.Info("uploaded incremental snapshot", zap.String("snapshotName", snapshotName), zap.Int("files", len(manifest.Entries)))
+	var size int64
+	for _, entry := range manifest.Entries {
+		size += entry.Size
+	}
+
+	return backupResult{snapshotName, now, size}, nil
+}
+
+// Runs save-off and save-all flush on the minecraft server so that world files are not written to while f runs.
+// save-on is always sent after f returns, including when saving fails or times out.
+// If RCON is unavailable f runs without pausing saves
+func withSavingPaused(cfg config.BackupConfig, f func() error) error {
+	timeout := cfg.GetSaveTimeout()
+
+	rc, err := rcon.Dial(cfg.GetHost(), cfg.GetRCONPort(), cfg.GetRCONPassword())
+	if err != nil {
+		logger.Warn("error connecting to RCON. skipping save-off and save-all", zap.Error(err))
+		return f()
 	}
 
 	defer rc.Close()
 
-	reqId, err := rc.Write("save-all")
+	defer func() {
+		res, err := rc.Command("save-on", timeout)
+		if err != nil {
+			logger.Error("error re-enabling automatic saving", zap.Error(err))
+			return
+		}
+		logger.Info(res)
+	}()
+
+	res, err := rc.Command("save-off", timeout)
 	if err != nil {
-		return err
+		return fmt.Errorf("save-off: %w", err)
+	}
+
+	logger.Info(res)
+
+	// save-all flush writes all pending chunks synchronously and responds once the save is complete
+	res, err = rc.CommandUntil("save-all flush", saveCompleteMsg, timeout)
+	if err != nil {
+		return fmt.Errorf("save-all flush: %w", err)
+	}
+
+	logger.Info(res)
+
+	return f()
+}
+
+// Returns the version reported by the server's status ping, or an empty string if the server can't be pinged
+func serverVersion(cfg config.ServerConfig) string {
+	info, err := newPinger(cfg).PingWithTimeout()
+	if err != nil {
+		logger.Warn("error pinging server for its version", zap.Error(err))
+		return ""
+	}
+
+	return info.Version
+}
+
+// Deletes this server's backups with the given name prefix that fall outside of the configured retention policy
+func pruneBackups(client backup.BackupClient, cfg config.BackupConfig, prefix string) error {
+	policy := backup.RetentionPolicy{
+		KeepLast:    cfg.GetRetentionKeepLast(),
+		KeepDaily:   cfg.GetRetentionKeepDaily(),
+		KeepWeekly:  cfg.GetRetentionKeepWeekly(),
+		KeepMonthly: cfg.GetRetentionKeepMonthly(),
+		MaxAge:      cfg.GetRetentionMaxAge(),
 	}
 
-	res, resId, err := rc.Read()
+	if policy.IsZero() {
+		return nil
+	}
+
+	objs, err := client.List(prefix)
 	if err != nil {
 		return err
 	}
 
-	if reqId != resId {
-		logger.Warn("mismatch RCON request and response id", zap.Int("reqId", reqId), zap.Int("resId", resId))
+	// only consider backups made by this server. other servers may share the name prefix
+	var owned []backup.Object
+	for _, obj := range objs {
+		if backup.IsManifest(obj.Name) {
+			continue
+		}
+
+		if server, _, ok := backup.ParseName(path.Base(obj.Name)); ok && server == cfg.GetPodName() {
+			owned = append(owned, obj)
+		}
 	}
 
-	logger.Info(res)
+	for _, obj := range policy.Prune(owned, time.Now()) {
+		if cfg.GetRetentionDryRun() {
+			logger.Info("dry run. would delete backup", zap.String("backupName", obj.Name), zap.Time("timestamp", obj.Timestamp()))
+			continue
+		}
+
+		if err := deleteBackup(client, obj.Name); err != nil {
+			return err
+		}
+
+		logger.Info("deleted backup", zap.String("backupName", obj.Name), zap.Time("timestamp", obj.Timestamp()))
+	}
 
 	return nil
 }
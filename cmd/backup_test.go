@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/rcon"
+	"github.com/raefon/agones-mc/pkg/rcon/rcontest"
+)
+
+// Backup config pointing at a fake RCON server. Other getters are not used by the tests
+type rconConfig struct {
+	config.BackupConfig
+	server  *rcontest.Server
+	timeout time.Duration
+}
+
+func (c rconConfig) GetHost() string               { return c.server.Host }
+func (c rconConfig) GetRCONPort() int              { return c.server.Port }
+func (c rconConfig) GetRCONPassword() string       { return c.server.Password }
+func (c rconConfig) GetSaveTimeout() time.Duration { return c.timeout }
+
+// Starts a fake server that answers save-all flush like a Minecraft server, or not at all if hang is set
+func newSaveServer(t *testing.T, hang bool) rconConfig {
+	t.Helper()
+
+	server, err := rcontest.NewServer("minecraft", func(cmd string) []string {
+		switch cmd {
+		case "save-off":
+			return []string{"Automatic saving is now disabled"}
+		case "save-all flush":
+			if hang {
+				return nil
+			}
+			return []string{"Saving the game (this may take a moment!)", "Saved the game"}
+		case "save-on":
+			return []string{"Automatic saving is now enabled"}
+		default:
+			return []string{"Unknown command"}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { server.Close() })
+	return rconConfig{server: server, timeout: 200 * time.Millisecond}
+}
+
+func TestWithSavingPaused(t *testing.T) {
+	cfg := newSaveServer(t, false)
+
+	var during []string
+	err := withSavingPaused(cfg, func() error {
+		during = cfg.server.Commands()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("withSavingPaused() = %v", err)
+	}
+
+	// the world is only read once the save is flushed
+	if want := []string{"save-off", "save-all flush"}; !reflect.DeepEqual(during, want) {
+		t.Errorf("commands before f = %v, want %v", during, want)
+	}
+
+	if got, want := cfg.server.Commands(), []string{"save-off", "save-all flush", "save-on"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+}
+
+func TestWithSavingPausedError(t *testing.T) {
+	cfg := newSaveServer(t, false)
+	archiveErr := errors.New("disk full")
+
+	err := withSavingPaused(cfg, func() error {
+		return archiveErr
+	})
+	if !errors.Is(err, archiveErr) {
+		t.Errorf("withSavingPaused() = %v, want %v", err, archiveErr)
+	}
+
+	if got, want := cfg.server.Commands(), []string{"save-off", "save-all flush", "save-on"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+}
+
+func TestWithSavingPausedTimeout(t *testing.T) {
+	cfg := newSaveServer(t, true)
+
+	called := false
+	err := withSavingPaused(cfg, func() error {
+		called = true
+		return nil
+	})
+	if !errors.Is(err, rcon.ErrTimeout) {
+		t.Errorf("withSavingPaused() = %v, want a timeout", err)
+	}
+
+	if called {
+		t.Error("f ran although the save did not complete")
+	}
+
+	// save-on is sent over a new connection after the timeout
+	if got, want := cfg.server.Commands(), []string{"save-off", "save-all flush", "save-on"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/backup"
+	"github.com/raefon/agones-mc/pkg/backup/incremental"
+)
+
+var backupsCmd = cobra.Command{
+	Use:   "backups",
+	Short: "Manages minecraft world backups",
+	Long:  "backups is for listing, inspecting, deleting and downloading world backups in backup storage",
+}
+
+var backupsListCmd = cobra.Command{
+	Use:          "list",
+	Short:        "Lists world backups",
+	Long:         "Lists world backups in backup storage, newest first. Use --prefix to only list backups and incremental snapshots of a GameServer",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		prefix, _ := cmd.Flags().GetString("prefix")
+		output, _ := cmd.Flags().GetString("output")
+
+		return withBackupClient(func(client backup.BackupClient) error {
+			objs, err := listBackups(client, prefix)
+			if err != nil {
+				return err
+			}
+
+			infos := make([]backupInfo, 0, len(objs))
+			for _, obj := range objs {
+				infos = append(infos, newBackupInfo(obj))
+			}
+
+			return printBackups(cmd.OutOrStdout(), output, infos)
+		})
+	},
+}
+
+// Lists the backups and incremental snapshots whose name starts with prefix, newest first. Snapshots are stored under
+// their own prefix, so they are listed separately
+func listBackups(client backup.BackupClient, prefix string) ([]backup.Object, error) {
+	prefixes := []string{prefix}
+	if prefix != "" && !strings.HasPrefix(prefix, incremental.SnapshotPrefix) {
+		prefixes = append(prefixes, incremental.SnapshotPrefix+prefix)
+	}
+
+	var objs []backup.Object
+	for _, p := range prefixes {
+		listed, err := client.List(p)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, obj := range listed {
+			// blobs are parts of incremental snapshots, leases mark snapshots in progress and manifests describe backups.
+			// none are backups
+			if strings.HasPrefix(obj.Name, incremental.BlobPrefix) || strings.HasPrefix(obj.Name, incremental.LeasePrefix) || backup.IsManifest(obj.Name) {
+				continue
+			}
+			objs = append(objs, obj)
+		}
+	}
+
+	sort.SliceStable(objs, func(i, j int) bool {
+		return objs[i].Timestamp().After(objs[j].Timestamp())
+	})
+
+	return objs, nil
+}
+
+var backupsInspectCmd = cobra.Command{
+	Use:          "inspect <name>",
+	Short:        "Shows details of a world backup",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+
+		return withBackupClient(func(client backup.BackupClient) error {
+			obj, err := client.Stat(args[0])
+			if err != nil {
+				return err
+			}
+
+			return printBackups(cmd.OutOrStdout(), output, []backupInfo{newBackupInfo(obj)})
+		})
+	},
+}
+
+var backupsDeleteCmd = cobra.Command{
+	Use:          "delete <name>...",
+	Short:        "Deletes world backups",
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withBackupClient(func(client backup.BackupClient) error {
+			for _, name := range args {
+				if err := deleteBackup(client, name); err != nil {
+					return err
+				}
+
+				logger.Info("deleted backup", zap.String("backupName", name))
+			}
+
+			return nil
+		})
+	},
+}
+
+var backupsDownloadCmd = cobra.Command{
+	Use:          "download <name> [file]",
+	Short:        "Downloads a world backup",
+	Long:         "Downloads a world backup to a file. Defaults to the backup name in the current directory. Use - to write to stdout",
+	Args:         cobra.RangeArgs(1, 2),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		target := path.Base(name)
+		if len(args) == 2 {
+			target = args[1]
+		}
+
+		return withBackupClient(func(client backup.BackupClient) error {
+			if target == "-" {
+				return client.Download(name, cmd.OutOrStdout())
+			}
+
+			file, err := os.Create(target)
+			if err != nil {
+				return err
+			}
+
+			defer file.Close()
+
+			if err := client.Download(name, file); err != nil {
+				return err
+			}
+
+			logger.Info("downloaded backup", zap.String("backupName", name), zap.String("file", target))
+			return nil
+		})
+	},
+}
+
+var backupsVerifyCmd = cobra.Command{
+	Use:          "verify <name>",
+	Short:        "Verifies a world backup",
+	Long:         "Downloads a world backup and checks it against the checksums in its integrity manifest. Incremental snapshots are checked against the chunk hashes in the snapshot manifest",
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		return withBackupClient(func(client backup.BackupClient) error {
+			if incremental.IsSnapshot(name) {
+				if err := incremental.Verify(client, name); err != nil {
+					return err
+				}
+
+				logger.Info("snapshot verified", zap.String("backupName", name))
+				return nil
+			}
+
+			obj, err := client.Stat(name)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.CreateTemp("", ".backup-*")
+			if err != nil {
+				return err
+			}
+
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			if err := client.Download(name, file); err != nil {
+				return err
+			}
+
+			if err := verifyBackup(client, name, file.Name(), obj.ContentType); err != nil {
+				return err
+			}
+
+			logger.Info("backup verified", zap.String("backupName", name))
+			return nil
+		})
+	},
+}
+
+var backupsGCCmd = cobra.Command{
+	Use:          "gc",
+	Short:        "Deletes unreferenced incremental backup blobs",
+	Long:         "Deletes incremental backup blobs that are not referenced by any snapshot manifest, e.g. after snapshots were pruned or deleted. Fails while a snapshot is being uploaded",
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		grace, _ := cmd.Flags().GetDuration("grace")
+
+		return withBackupClient(func(client backup.BackupClient) error {
+			blobs, err := incremental.Unreferenced(client, grace, time.Now())
+			if err != nil {
+				return err
+			}
+
+			var freed int64
+			for _, blob := range blobs {
+				if dryRun {
+					logger.Info("dry run. would delete blob", zap.String("blob", blob.Name), zap.Int64("size", blob.Size))
+					continue
+				}
+
+				if err := client.Delete(blob.Name); err != nil {
+					return err
+				}
+
+				freed += blob.Size
+			}
+
+			logger.Info("garbage collection complete", zap.Int("unreferenced", len(blobs)), zap.Bool("dryRun", dryRun), zap.String("freed", formatSize(freed)))
+			return nil
+		})
+	},
+}
+
+func init() {
+	backupsListCmd.Flags().String("prefix", "", "only list backups whose name starts with prefix (e.g. a GameServer name)")
+	backupsListCmd.Flags().StringP("output", "o", "table", "output format. table or json")
+	backupsInspectCmd.Flags().StringP("output", "o", "table", "output format. table or json")
+
+	backupsGCCmd.Flags().Bool("dry-run", false, "log blobs that would be deleted without deleting them")
+	backupsGCCmd.Flags().Duration("grace", time.Hour, "keep blobs uploaded within this duration. snapshots that started within it block garbage collection until they are uploaded")
+
+	backupsCmd.AddCommand(&backupsListCmd, &backupsInspectCmd, &backupsDeleteCmd, &backupsDownloadCmd, &backupsVerifyCmd, &backupsGCCmd)
+	RootCmd.AddCommand(&backupsCmd)
+}
+
+// Backup details for table and json output
+type backupInfo struct {
+	Name        string    `json:"name"`
+	Server      string    `json:"server,omitempty"`
+	Timestamp   time.Time `json:"timestamp"`
+	Size        int64     `json:"size"`
+	Created     time.Time `json:"created"`
+	ContentType string    `json:"contentType,omitempty"`
+}
+
+func newBackupInfo(obj backup.Object) backupInfo {
+	server, _, _ := backup.ParseName(path.Base(obj.Name))
+
+	return backupInfo{
+		Name:        obj.Name,
+		Server:      server,
+		Timestamp:   obj.Timestamp(),
+		Size:        obj.Size,
+		Created:     obj.Created,
+		ContentType: obj.ContentType,
+	}
+}
+
+// Deletes a backup and its integrity manifest, if it has one
+func deleteBackup(client backup.BackupClient, name string) error {
+	if err := client.Delete(name); err != nil {
+		return err
+	}
+
+	if _, err := client.Stat(backup.ManifestName(name)); errors.Is(err, backup.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return client.Delete(backup.ManifestName(name))
+}
+
+// Creates a backup client from the environment and closes it after f returns
+func withBackupClient(f func(client backup.BackupClient) error) error {
+	client, err := newBackupClient(context.Background(), config.NewBackupsConfig())
+	if err != nil {
+		return err
+	}
+
+	defer client.Close()
+
+	return f(client)
+}
+
+func printBackups(w io.Writer, output string, infos []backupInfo) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSERVER\tTIMESTAMP\tSIZE")
+		for _, info := range infos {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Name, info.Server, info.Timestamp.Format(time.RFC3339), formatSize(info.Size))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+}
+
+// Formats a byte count with a binary unit suffix
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
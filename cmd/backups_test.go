@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+	"github.com/raefon/agones-mc/pkg/backup/local"
+)
+
+// Backup client whose Stat fails
+type statErrorClient struct {
+	backup.BackupClient
+	err error
+}
+
+func (c *statErrorClient) Stat(name string) (backup.Object, error) {
+	return backup.Object{}, c.err
+}
+
+func TestDeleteBackup(t *testing.T) {
+	const name = "mc-server-2021-05-09T03:35:00Z.zip"
+
+	tests := []struct {
+		name         string
+		manifest     bool
+		statErr      error
+		wantErr      bool
+		wantManifest bool
+	}{
+		{"with manifest", true, nil, false, false},
+		{"without manifest", false, nil, false, false},
+		{"manifest stat fails", true, errors.New("403 forbidden"), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := local.New(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			objs := []string{name}
+			if tt.manifest {
+				objs = append(objs, backup.ManifestName(name))
+			}
+			for _, obj := range objs {
+				if err := store.Backup(obj, bytes.NewReader(nil), backup.UploadOptions{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			client := store
+			if tt.statErr != nil {
+				client = &statErrorClient{store, tt.statErr}
+			}
+
+			if err := deleteBackup(client, name); (err != nil) != tt.wantErr {
+				t.Errorf("deleteBackup() = %v, want error %v", err, tt.wantErr)
+			}
+
+			if _, err := store.Stat(name); !errors.Is(err, backup.ErrNotFound) {
+				t.Errorf("backup not deleted: %v", err)
+			}
+			if _, err := store.Stat(backup.ManifestName(name)); (err == nil) != tt.wantManifest {
+				t.Errorf("manifest Stat() = %v, want manifest kept %v", err, tt.wantManifest)
+			}
+		})
+	}
+}
+
+func TestListBackups(t *testing.T) {
+	client, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{
+		"mc-server-2021-05-09T01:00:00Z.zip",
+		backup.ManifestName("mc-server-2021-05-09T01:00:00Z.zip"),
+		"snapshots/mc-server-2021-05-09T03:00:00Z.json",
+		"snapshots/mc-other-2021-05-09T04:00:00Z.json",
+		"mc-server-2021-05-09T02:00:00Z.tar.zst",
+		"blobs/ab/abcdef",
+	} {
+		if err := client.Backup(name, bytes.NewReader(nil), backup.UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{"mc-server", []string{
+			"snapshots/mc-server-2021-05-09T03:00:00Z.json",
+			"mc-server-2021-05-09T02:00:00Z.tar.zst",
+			"mc-server-2021-05-09T01:00:00Z.zip",
+		}},
+		{"snapshots/", []string{
+			"snapshots/mc-other-2021-05-09T04:00:00Z.json",
+			"snapshots/mc-server-2021-05-09T03:00:00Z.json",
+		}},
+		{"", []string{
+			"snapshots/mc-other-2021-05-09T04:00:00Z.json",
+			"snapshots/mc-server-2021-05-09T03:00:00Z.json",
+			"mc-server-2021-05-09T02:00:00Z.tar.zst",
+			"mc-server-2021-05-09T01:00:00Z.zip",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.prefix, func(t *testing.T) {
+			objs, err := listBackups(client, tt.prefix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, obj := range objs {
+				got = append(got, obj.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("listBackups(%q) = %v, want %v", tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
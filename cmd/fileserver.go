@@ -6,6 +6,7 @@ import (
 
 	"github.com/raefon/agones-mc/internal/config"
 	"github.com/raefon/agones-mc/pkg/fileserver"
+	"github.com/raefon/agones-mc/pkg/metrics"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 )
@@ -37,8 +38,11 @@ func Run() error {
 		port = "8081"
 	}
 
-	// 3. Define the Request Handler
-	http.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+	// 3. Define the Request Handler, counting requests and transferred bytes for /metrics
+	metrics.RegisterFileServer()
+	http.Handle("/metrics", metrics.Handler())
+
+	http.Handle("/", metrics.InstrumentFileServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
 		var err error
 
 		switch r.Method {
@@ -70,7 +74,7 @@ func Run() error {
 				zap.Error(err),
 			)
 		}
-	})
+	})))
 
 	// 4. Start the Server
 	logger.Info("starting web file manager",
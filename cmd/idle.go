@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sdk "agones.dev/agones/sdks/go"
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/ping"
+	"github.com/raefon/agones-mc/pkg/rcon"
+)
+
+// Max time to wait for the final backup of an idle server
+const idleBackupTimeout = 30 * time.Minute
+
+// Shuts the server down once it has been empty for IDLE_TIMEOUT
+type idleWatcher struct {
+	cfg config.MonitorConfig
+	sdk *sdk.SDK
+
+	// nil unless only allocated servers count as idle
+	state *gameServerState
+
+	mu     sync.Mutex
+	online int32
+	// start of the current idle period. Zero while players are online
+	emptySince   time.Time
+	shuttingDown bool
+}
+
+// Creates an idle watcher. With IDLE_ONLY_ALLOCATED only allocated servers count as idle, so state must be the watched
+// state of the GameServer
+func newIdleWatcher(cfg config.MonitorConfig, s *sdk.SDK, state *gameServerState) *idleWatcher {
+	w := &idleWatcher{cfg: cfg, sdk: s}
+
+	if cfg.GetIdleOnlyAllocated() {
+		w.state = state
+	}
+
+	return w
+}
+
+// Records the player count of a ping. Starts the shutdown once the server has been idle for IDLE_TIMEOUT
+func (w *idleWatcher) Observe(info *ping.ServerInfo) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.online = info.OnlinePlayers
+	if w.shuttingDown {
+		return
+	}
+
+	if w.online > 0 || (w.state != nil && w.state.Get() != allocatedState) {
+		w.emptySince = time.Time{}
+		return
+	}
+
+	now := time.Now()
+	if w.emptySince.IsZero() {
+		w.emptySince = now
+		return
+	}
+
+	if now.Sub(w.emptySince) < w.cfg.GetIdleTimeout() {
+		return
+	}
+
+	w.shuttingDown = true
+	go w.shutdown()
+}
+
+// Warns players joining in the meantime, waits IDLE_GRACE_PERIOD, backs up and shuts the GameServer down.
+// The shutdown is canceled if a player is online after the grace period
+func (w *idleWatcher) shutdown() {
+	logger.Info("server idle. shutting down", zap.Duration("idleTimeout", w.cfg.GetIdleTimeout()), zap.Duration("gracePeriod", w.cfg.GetIdleGracePeriod()))
+
+	if msg := w.cfg.GetIdleWarning(); msg != "" {
+		if err := w.warn(msg); err != nil {
+			logger.Warn("error sending idle warning", zap.Error(err))
+		}
+	}
+
+	time.Sleep(w.cfg.GetIdleGracePeriod())
+
+	w.mu.Lock()
+	online := w.online
+	w.mu.Unlock()
+
+	if online > 0 {
+		logger.Info("players online. idle shutdown canceled", zap.Int32("onlinePlayers", online))
+		w.reset()
+		return
+	}
+
+	// the backup sidecar still takes its own final backup on termination, so a failed backup doesn't keep the server up
+	if url := w.cfg.GetIdleBackupURL(); url != "" {
+		if err := triggerBackup(url); err != nil {
+			logger.Error("final backup of idle server failed", zap.Error(err))
+		} else {
+			logger.Info("final backup of idle server successful")
+		}
+	}
+
+	if err := w.sdk.Shutdown(); err != nil {
+		logger.Error("error shutting down idle server", zap.Error(err))
+		w.reset()
+	}
+}
+
+// Starts a new idle period
+func (w *idleWatcher) reset() {
+	w.mu.Lock()
+	w.shuttingDown = false
+	w.emptySince = time.Time{}
+	w.mu.Unlock()
+}
+
+// Sends the warning command to the server console
+func (w *idleWatcher) warn(cmd string) error {
+	rc, err := rcon.Dial(w.cfg.GetHost(), w.cfg.GetRCONPort(), w.cfg.GetRCONPassword())
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	_, err = rc.Command(cmd, w.cfg.GetTimeout())
+	return err
+}
+
+// Requests a backup from the backup trigger at url, e.g. http://localhost:8082/backup?wait=true
+func triggerBackup(url string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), idleBackupTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorLength))
+		return fmt.Errorf("%s: %s", res.Status, strings.TrimSpace(string(body)))
+	}
+
+	return nil
+}
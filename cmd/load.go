@@ -2,26 +2,33 @@ package cmd
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 
 	"github.com/raefon/agones-mc/internal/config"
-	"github.com/raefon/agones-mc/pkg/backup/google"
+	"github.com/raefon/agones-mc/pkg/backup"
+	"github.com/raefon/agones-mc/pkg/backup/incremental"
+	"github.com/raefon/agones-mc/pkg/layers"
 )
 
+// BACKUP_NAME that loads the newest backup
+const latestBackup = "latest"
+
 var loadCmd = cobra.Command{
 	Use:   "load",
-	Short: "Loads minecraft world from Google Cloud Storage",
-	Long:  "Load is an init container process that will load a minecraft world save/backup from Google Cloud Storage and load it into a volume",
+	Short: "Loads minecraft world from backup storage",
+	Long:  "Load is an init container process that will load a minecraft world save/backup from backup storage (Google Cloud Storage, S3, Azure Blob Storage or a local directory), a URL or an OCI artifact and load it into a volume",
 	Run: func(cmd *cobra.Command, args []string) {
 		cfg := config.NewLoadConfig()
 
-		if cfg.GetBackupName() == "" {
-			logger.Info("no backup annotation. creating a new world")
-			return
-		}
-
 		logger.Info("loading saved world", zap.String("serverName", cfg.GetPodName()), zap.String("backupName", cfg.GetBackupName()))
 
 		if err := RunLoad(cfg); err != nil {
@@ -35,17 +42,383 @@ func init() {
 	RootCmd.AddCommand(&loadCmd)
 }
 
+// Loads the world, then applies the provisioning layers on top of the volume
 func RunLoad(cfg config.LoadConfig) error {
-	client, err := google.New(context.Background(), cfg.GetBucketName())
+	loaded, err := loadWorld(cfg)
 	if err != nil {
-		logger.Error("error connecting to bucket", zap.Error(err))
 		return err
 	}
 
-	if err := client.Load(cfg.GetBackupName(), cfg.GetVolume()); err != nil {
-		logger.Error("error loading world", zap.Error(err))
+	// a freshly loaded world may have replaced files of previously applied layers
+	return applyLayers(cfg, loaded)
+}
+
+// Loads the world backup into the volume. Returns whether a world was loaded
+func loadWorld(cfg config.LoadConfig) (bool, error) {
+	if cfg.GetBackupName() == "" && cfg.GetBackupPrefix() == "" {
+		logger.Info("no backup annotation. creating a new world")
+		return false, nil
+	}
+
+	mode := cfg.GetLoadMode()
+	if mode != config.ExtractLoad && mode != config.DownloadLoad {
+		return false, fmt.Errorf("unknown load mode %q. must be extract or download", mode)
+	}
+
+	existing := cfg.GetLoadExistingWorld()
+	if existing != config.PreserveWorld && existing != config.WipeWorld {
+		return false, fmt.Errorf("unknown existing world policy %q. must be preserve or wipe", existing)
+	}
+
+	// Keep a world that is already in the volume, e.g. a persistent volume on a restarted pod
+	if existing == config.PreserveWorld && worldExists(cfg) {
+		logger.Info("world already exists. skipping load", zap.String("worldDir", cfg.GetWorldDir()))
+		return false, nil
+	}
+
+	client, name, err := openBackup(context.Background(), cfg)
+	if err != nil {
+		logger.Error("error finding backup", zap.Error(err))
+		return false, err
+	}
+
+	defer client.Close()
+
+	if name == "" {
+		logger.Info("no matching backups. creating a new world")
+		return false, nil
+	}
+
+	if name != cfg.GetBackupName() && !isSourceURL(cfg.GetBackupName()) {
+		logger.Info("found latest backup", zap.String("backupName", name))
+	}
+
+	// Reassemble incremental snapshots from their manifest and blobs
+	if incremental.IsSnapshot(name) {
+		if mode == config.DownloadLoad {
+			return false, fmt.Errorf("incremental snapshots can't be loaded in download mode")
+		}
+
+		// a pin would have to cover the manifest and every blob, so it is refused rather than silently ignored
+		if cfg.GetBackupSHA256() != "" {
+			return false, fmt.Errorf("BACKUP_SHA256 can't be used with incremental snapshots. their chunks are verified against the hashes in the snapshot manifest")
+		}
+
+		if err := removeWorld(cfg); err != nil {
+			return false, err
+		}
+
+		if err := incremental.Restore(client, name, cfg.GetVolume(), cfg.GetLoadInclude(), cfg.GetLoadExclude()); err != nil {
+			logger.Error("error restoring snapshot", zap.Error(err))
+			return false, err
+		}
+
+		return true, nil
+	}
+
+	obj, err := client.Stat(name)
+	if err != nil {
+		logger.Error("error finding backup", zap.Error(err))
+		return false, err
+	}
+
+	// Download to the volume. the image may not have a writable temp dir
+	file, err := os.CreateTemp(cfg.GetVolume(), ".backup-*")
+	if err != nil {
+		logger.Error("error creating download file", zap.Error(err))
+		return false, err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := client.Download(name, file); err != nil {
+		logger.Error("error downloading world", zap.Error(err))
+		return false, err
+	}
+
+	// Refuse archives that don't match the pinned checksum
+	if pin := cfg.GetBackupSHA256(); pin != "" {
+		if err := verifyChecksum(file.Name(), pin); err != nil {
+			logger.Error("backup failed verification", zap.Error(err))
+			return false, err
+		}
+	}
+
+	// Refuse archives that don't match their integrity manifest. Backups taken before manifests were added have none
+	if err := verifyBackup(client, name, file.Name(), obj.ContentType); errors.Is(err, errNoManifest) {
+		logger.Warn("backup has no integrity manifest. skipping verification")
+	} else if err != nil {
+		logger.Error("backup failed verification", zap.Error(err))
+		return false, err
+	}
+
+	// Leave the archive in the volume for the server image to unpack, e.g. with the itzg/minecraft-server WORLD env variable
+	if mode == config.DownloadLoad {
+		format, err := backup.DetectFileFormat(file.Name(), obj.ContentType)
+		if err != nil {
+			return false, err
+		}
+
+		target := filepath.Join(cfg.GetVolume(), "world"+format.Ext())
+		if err := os.Rename(file.Name(), target); err != nil {
+			logger.Error("error moving downloaded world", zap.Error(err))
+			return false, err
+		}
+
+		logger.Info("downloaded world", zap.String("file", target))
+		return true, nil
+	}
+
+	if err := removeWorld(cfg); err != nil {
+		return false, err
+	}
+
+	// Restore archived files to their relative paths in the volume
+	err = backup.Extract(file.Name(), cfg.GetVolume(), obj.ContentType, backup.ExtractOptions{
+		WorldDir: cfg.GetWorldDir(),
+		Include:  cfg.GetLoadInclude(),
+		Exclude:  cfg.GetLoadExclude(),
+	})
+	if err != nil {
+		logger.Error("error extracting world", zap.Error(err))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Connects to the storage holding the backup to load and returns the backup's name in it.
+// BACKUP_NAME is either a source URL or the name of a backup in the configured storage backend
+func openBackup(ctx context.Context, cfg config.LoadConfig) (backup.BackupClient, string, error) {
+	if isSourceURL(cfg.GetBackupName()) {
+		return newSourceClient(ctx, cfg, cfg.GetBackupName(), false)
+	}
+
+	client, err := newBackupClient(ctx, cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name, err := resolveBackupName(client, cfg)
+	if err != nil {
+		client.Close()
+		return nil, "", err
+	}
+
+	return client, name, nil
+}
+
+// Returns the name of the backup to load. BACKUP_NAME=latest or BACKUP_PREFIX selects the newest backup or snapshot
+// whose name starts with the prefix, taken at or before BACKUP_BEFORE. Returns an empty name if no backup matches
+func resolveBackupName(client backup.BackupClient, cfg config.LoadConfig) (string, error) {
+	name := cfg.GetBackupName()
+	prefix := cfg.GetBackupPrefix()
+
+	if name != latestBackup && (name != "" || prefix == "") {
+		return name, nil
+	}
+
+	// without a prefix, latest refers to the backups of this GameServer
+	if prefix == "" {
+		prefix = cfg.GetPodName()
+	}
+
+	if prefix == "" {
+		return "", errors.New("BACKUP_NAME=latest needs BACKUP_PREFIX or POD_NAME to select backups")
+	}
+
+	var before time.Time
+	if s := cfg.GetBackupBefore(); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return "", fmt.Errorf("invalid BACKUP_BEFORE timestamp %q: %w", s, err)
+		}
+		before = t
+	}
+
+	var objs []backup.Object
+	for _, p := range []string{prefix, incremental.SnapshotPrefix + prefix} {
+		listed, err := client.List(p)
+		if err != nil {
+			return "", err
+		}
+		objs = append(objs, listed...)
+	}
+
+	latest, ok := backup.Latest(objs, before)
+	if !ok {
+		return "", nil
+	}
+
+	return latest.Name, nil
+}
+
+// Checks if the volume already has a world
+func worldExists(cfg config.LoadConfig) bool {
+	_, err := os.Stat(filepath.Join(cfg.GetVolume(), cfg.GetWorldDir(), "level.dat"))
+	return err == nil
+}
+
+// Deletes the world and its dimensions from the volume when the existing world should be wiped
+func removeWorld(cfg config.LoadConfig) error {
+	if cfg.GetLoadExistingWorld() != config.WipeWorld {
+		return nil
+	}
+
+	for _, dir := range cfg.GetWorldDirs() {
+		if err := os.RemoveAll(filepath.Join(cfg.GetVolume(), dir)); err != nil {
+			logger.Error("error removing existing world", zap.String("worldDir", dir), zap.Error(err))
+			return err
+		}
+	}
+
+	logger.Info("removed existing world", zap.Strings("worldDirs", cfg.GetWorldDirs()))
+	return nil
+}
+
+var errNoManifest = errors.New("backup has no integrity manifest")
+
+// Checks a downloaded backup archive against its integrity manifest. Returns errNoManifest if the backup has none.
+// Other errors finding the manifest fail, so an unreachable manifest doesn't skip verification
+func verifyBackup(client backup.BackupClient, name, src, contentType string) error {
+	if _, err := client.Stat(backup.ManifestName(name)); errors.Is(err, backup.ErrNotFound) {
+		return errNoManifest
+	} else if err != nil {
+		return err
+	}
+
+	m, err := backup.ReadManifest(client, name)
+	if err != nil {
+		return err
+	}
+
+	return m.Verify(src, contentType)
+}
+
+// Checks the SHA-256 of the file at src against a pinned hex encoded checksum, optionally prefixed with sha256:
+func verifyChecksum(src, pin string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	digest := backup.NewDigest()
+	if _, err := io.Copy(digest, file); err != nil {
+		return err
+	}
+
+	if want := strings.TrimPrefix(pin, "sha256:"); !strings.EqualFold(want, digest.Sum()) {
+		return fmt.Errorf("checksum mismatch. expected sha256:%s, got sha256:%s", want, digest.Sum())
+	}
+
+	return nil
+}
+
+// Applies the layers in LOAD_LAYERS and LOAD_LAYERS_FILE to the volume in order. Layers recorded in the lockfile are skipped
+// unless force is set or an earlier layer changed
+func applyLayers(cfg config.LoadConfig, force bool) error {
+	list, err := readLayers(cfg)
+	if err != nil {
+		logger.Error("invalid layers", zap.Error(err))
+		return err
+	}
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	volume := cfg.GetVolume()
+
+	lock, err := layers.ReadLock(volume)
+	if err != nil {
+		logger.Error("error reading layer lockfile", zap.Error(err))
 		return err
 	}
 
+	start := 0
+	if !force {
+		start = lock.Applied(list)
+	}
+
+	for i := start; i < len(list); i++ {
+		layer := list[i]
+
+		client, name, err := openLayer(context.Background(), cfg, layer)
+		if err != nil {
+			logger.Error("error opening layer source", zap.String("layer", layer.Name), zap.Error(err))
+			return err
+		}
+
+		digest, err := layers.Apply(client, name, layer, volume)
+		client.Close()
+		if err != nil {
+			logger.Error("error applying layer", zap.String("layer", layer.Name), zap.Error(err))
+			return err
+		}
+
+		// record every layer as it is applied so a failed load resumes after the last applied layer
+		lock.Record(i, layer, digest, time.Now())
+		if err := lock.Write(volume); err != nil {
+			logger.Error("error writing layer lockfile", zap.Error(err))
+			return err
+		}
+
+		logger.Info("applied layer", zap.String("layer", layer.Name), zap.String("target", layer.Target))
+	}
+
+	// forget layers that were removed from the end of the list
+	if len(lock.Layers) > len(list) {
+		lock.Layers = lock.Layers[:len(list)]
+		if err := lock.Write(volume); err != nil {
+			logger.Error("error writing layer lockfile", zap.Error(err))
+			return err
+		}
+	}
+
+	if start == len(list) {
+		logger.Info("layers already applied", zap.Int("layers", len(list)))
+	}
+
 	return nil
 }
+
+// Parses the layers in LOAD_LAYERS followed by the layers in LOAD_LAYERS_FILE
+func readLayers(cfg config.LoadConfig) ([]layers.Layer, error) {
+	var list []layers.Layer
+
+	if data := cfg.GetLoadLayers(); data != "" {
+		parsed, err := layers.Parse([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, parsed...)
+	}
+
+	if file := cfg.GetLoadLayersFile(); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := layers.Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		list = append(list, parsed...)
+	}
+
+	return list, nil
+}
+
+// Connects to the storage holding a layer source. Sources are either URLs or names in the configured storage backend
+func openLayer(ctx context.Context, cfg config.LoadConfig, layer layers.Layer) (backup.BackupClient, string, error) {
+	if isSourceURL(layer.Source) {
+		return newSourceClient(ctx, cfg, layer.Source, layer.Type == layers.DirectoryLayer)
+	}
+
+	client, err := newBackupClient(ctx, cfg)
+	return client, layer.Source, err
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raefon/agones-mc/internal/config"
+)
+
+// Returns a zip archive of a world with only a level.dat
+func worldZip(t *testing.T) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("world/level.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("level")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestLoadFromURL(t *testing.T) {
+	archive := worldZip(t)
+	sum := sha256.Sum256(archive)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/world.zip" {
+			http.NotFound(rw, r)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/zip")
+		rw.Write(archive)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		pin     string
+		wantErr bool
+	}{
+		{"no pin", "", false},
+		{"matching pin", "sha256:" + hex.EncodeToString(sum[:]), false},
+		{"wrong pin", strings.Repeat("0", 64), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			volume := t.TempDir()
+			t.Setenv(config.VOLUME, volume)
+			t.Setenv(config.BACKUP_NAME, server.URL+"/world.zip")
+			t.Setenv(config.BACKUP_SHA256, tt.pin)
+
+			loaded, err := loadWorld(config.NewLoadConfig())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("loadWorld() with a wrong checksum succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !loaded {
+				t.Error("loadWorld() = false, want true")
+			}
+			if _, err := os.Stat(filepath.Join(volume, "world", "level.dat")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoadSnapshotRejectsPin(t *testing.T) {
+	t.Setenv(config.VOLUME, t.TempDir())
+	t.Setenv(config.STORAGE_BACKEND, string(config.LocalBackend))
+	t.Setenv(config.BUCKET_NAME, t.TempDir())
+	t.Setenv(config.BACKUP_NAME, "snapshots/mc-server-2021-05-09T03:35:00Z.json")
+	t.Setenv(config.BACKUP_SHA256, strings.Repeat("0", 64))
+
+	_, err := loadWorld(config.NewLoadConfig())
+	if err == nil || !strings.Contains(err.Error(), "BACKUP_SHA256") {
+		t.Errorf("loadWorld() = %v, want BACKUP_SHA256 error", err)
+	}
+}
+
+func TestLoadManifestError(t *testing.T) {
+	archive := worldZip(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// the manifest exists but can't be read
+		if strings.HasSuffix(r.URL.Path, ".manifest.json") {
+			http.Error(rw, "forbidden", http.StatusForbidden)
+			return
+		}
+		rw.Header().Set("Content-Type", "application/zip")
+		rw.Write(archive)
+	}))
+	defer server.Close()
+
+	volume := t.TempDir()
+	t.Setenv(config.VOLUME, volume)
+	t.Setenv(config.BACKUP_NAME, server.URL+"/world.zip")
+
+	if _, err := loadWorld(config.NewLoadConfig()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("loadWorld() = %v, want 403 error", err)
+	}
+	if _, err := os.Stat(filepath.Join(volume, "world")); !os.IsNotExist(err) {
+		t.Errorf("world extracted without verification: %v", err)
+	}
+}
+
+func TestLoadSourceWithoutName(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, source := range []string{"file://" + dir + "/", "s3://bucket", "s3://bucket/"} {
+		t.Run(source, func(t *testing.T) {
+			t.Setenv(config.VOLUME, t.TempDir())
+			t.Setenv(config.BACKUP_NAME, source)
+
+			loaded, err := loadWorld(config.NewLoadConfig())
+			if err == nil || !strings.Contains(err.Error(), "no object name") {
+				t.Errorf("loadWorld() = %v, want no object name error", err)
+			}
+			if loaded {
+				t.Error("loadWorld() = true, want false")
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	// set by the root command outside of tests
+	logger = zap.NewNop()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/ping"
+)
+
+// Server info fields that can be published, and their GameServer metadata keys. The Agones SDK prefixes the keys with agones.dev/sdk-
+var metadataKeys = map[string]string{
+	"version":  "mc-version",
+	"protocol": "mc-protocol",
+	"motd":     "mc-motd",
+	"gamemode": "mc-game-mode",
+	"level":    "mc-level-name",
+	"mods":     "mc-mods",
+}
+
+// Max length of a label value
+const maxLabelLength = 63
+
+// Characters not allowed in label values
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// Sets GameServer labels and annotations, skipping values that didn't change since they were last set
+type metadataPublisher struct {
+	sdk metadataSetter
+
+	// last published values by kind and key
+	published map[string]string
+}
+
+func newMetadataPublisher(sdk metadataSetter) *metadataPublisher {
+	return &metadataPublisher{sdk: sdk, published: map[string]string{}}
+}
+
+// Sets a label. Errors are logged and the label is set again on the next call
+func (p *metadataPublisher) Label(key, value string) {
+	p.publish("label", key, value, p.sdk.SetLabel)
+}
+
+// Sets an annotation. Errors are logged and the annotation is set again on the next call
+func (p *metadataPublisher) Annotation(key, value string) {
+	p.publish("annotation", key, value, p.sdk.SetAnnotation)
+}
+
+func (p *metadataPublisher) publish(kind, key, value string, set func(key, value string) error) {
+	id := kind + "/" + key
+	if last, ok := p.published[id]; ok && last == value {
+		return
+	}
+
+	if err := set(key, value); err != nil {
+		logger.Warn("error publishing server metadata", zap.String(kind, key), zap.Error(err))
+		return
+	}
+
+	p.published[id] = value
+}
+
+// Publishes server info to the GameServer's labels and annotations
+type serverMetadata struct {
+	publisher   *metadataPublisher
+	labels      []string
+	annotations []string
+}
+
+// Creates a publisher of the configured fields. Returns nil if no fields are configured
+func newServerMetadata(cfg config.MonitorConfig, s metadataSetter) (*serverMetadata, error) {
+	labels, annotations := cfg.GetMetadataLabels(), cfg.GetMetadataAnnotations()
+	if len(labels) == 0 && len(annotations) == 0 {
+		return nil, nil
+	}
+
+	for _, field := range append(labels, annotations...) {
+		if _, ok := metadataKeys[field]; !ok {
+			return nil, fmt.Errorf("unknown server metadata field %q. must be version, protocol, motd, gamemode, level or mods", field)
+		}
+	}
+
+	return &serverMetadata{publisher: newMetadataPublisher(s), labels: labels, annotations: annotations}, nil
+}
+
+// Updates the fields that changed since the last ping. Failed updates are retried on the next ping
+func (m *serverMetadata) Observe(info *ping.ServerInfo) {
+	for _, field := range m.labels {
+		m.publisher.Label(metadataKeys[field], labelValue(metadataValue(field, info)))
+	}
+
+	for _, field := range m.annotations {
+		m.publisher.Annotation(metadataKeys[field], metadataValue(field, info))
+	}
+}
+
+// Value of a server info field
+func metadataValue(field string, info *ping.ServerInfo) string {
+	switch field {
+	case "version":
+		return info.Version
+	case "protocol":
+		return strconv.Itoa(int(info.Protocol))
+	case "motd":
+		return info.MOTD
+	case "gamemode":
+		return info.GameMode
+	case "level":
+		return info.LevelName
+	default:
+		return strings.Join(info.Mods, ",")
+	}
+}
+
+// Turns value into a valid label value, e.g. "Paper 1.21.1" into "Paper_1.21.1"
+func labelValue(value string) string {
+	value = invalidLabelChars.ReplaceAllString(value, "_")
+	if len(value) > maxLabelLength {
+		value = value[:maxLabelLength]
+	}
+
+	// label values must start and end with an alphanumeric character
+	return strings.Trim(value, "_.-")
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/pkg/metrics"
+)
+
+// Serves the registered Prometheus metrics on addr at /metrics until ctx is done. Does nothing if addr is empty
+func serveMetrics(ctx context.Context, addr string) {
+	if addr == "" {
+		return
+	}
+
+	server := metrics.NewServer(addr)
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		logger.Info("serving metrics", zap.String("addr", addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server error", zap.Error(err))
+		}
+	}()
+}
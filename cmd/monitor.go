@@ -1,14 +1,17 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"os"
 	"time"
 
+	sdk "agones.dev/agones/sdks/go"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 
 	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/metrics"
 	"github.com/raefon/agones-mc/pkg/ping"
 	"github.com/raefon/agones-mc/pkg/signal"
 )
@@ -28,13 +31,87 @@ func init() {
 func RunMonitor(cmd *cobra.Command, args []string) {
 	cfg := config.NewMonitorConfig()
 
-	// Create new timed pinger
-	pinger, err := ping.NewTimed(cfg.GetHost(), uint16(cfg.GetPort()), cfg.GetTimeout(), cfg.GetEdition())
+	// Create timed pingers for the ready and health checks
+	ready, health, err := ping.NewChecks(cfg)
 
 	if err != nil {
-		logger.Fatal("error creating ping client", zap.Error(err))
+		logger.Fatal("invalid health checks", zap.Error(err))
 	}
 
+	// One connection to the local Agones server, shared by the health checks and every feature below
+	s, err := sdk.NewSDK()
+	if err != nil {
+		logger.Fatal("error connecting to the Agones SDK server", zap.Error(err))
+	}
+
+	// One WatchGameServer stream, shared by the features that act on the GameServer's state
+	var state *gameServerState
+	if cfg.GetAutoAllocate() || cfg.GetMaintenanceCron() != "" || (cfg.GetIdleTimeout() > 0 && cfg.GetIdleOnlyAllocated()) {
+		if state, err = watchGameServerState(s); err != nil {
+			logger.Fatal("error watching GameServer", zap.Error(err))
+		}
+	}
+
+	// Query the tick rate, failing the health check while lagging with LAG_ACTION=unhealthy
+	if cfg.GetTPSInterval() > 0 {
+		ticks, err := newTickMonitor(cfg, s)
+		if err != nil {
+			logger.Fatal("error starting tick rate monitor", zap.Error(err))
+		}
+
+		if cfg.GetLagAction() == config.UnhealthyLagAction {
+			health.Add(lagCheck, ticks.check())
+		}
+
+		go ticks.Run(context.Background())
+	}
+
+	// the player counts of the health checks drive these features, so they can't silently do nothing
+	if !ping.ReportsPlayers(health) && usesPlayerCounts(cfg) {
+		logger.Fatal("PLAYER_TRACKING, IDLE_TIMEOUT, METADATA_LABELS, METADATA_ANNOTATIONS, AUTO_ALLOCATE and MAINTENANCE_CRON need a health check that reports player counts: status, query or rcon with the list command", zap.Strings("healthChecks", health.Names))
+	}
+
+	pinger := ping.NewChecked(s, ready, health)
+
+	tracker, err := ping.NewPlayerTracker(s, cfg.GetPlayerTracking(), cfg.GetPlayerCounter(), cfg.GetPlayerList())
+	if err != nil {
+		logger.Fatal("error creating player tracker", zap.Error(err))
+	}
+
+	if tracker != nil {
+		// tracking errors don't fail the health check
+		pinger.OnPing(func(info *ping.ServerInfo) {
+			if err := tracker.Track(info); err != nil {
+				logger.Warn("error tracking players", zap.Error(err))
+			}
+		})
+	}
+
+	if cfg.GetIdleTimeout() > 0 {
+		pinger.OnPing(newIdleWatcher(cfg, s, state).Observe)
+	}
+
+	metadata, err := newServerMetadata(cfg, s)
+	if err != nil {
+		logger.Fatal("error creating server metadata publisher", zap.Error(err))
+	}
+
+	if metadata != nil {
+		pinger.OnPing(metadata.Observe)
+	}
+
+	if cfg.GetAutoAllocate() || cfg.GetMaintenanceCron() != "" {
+		allocator, err := newAllocator(cfg, s, state)
+		if err != nil {
+			logger.Fatal("error starting allocator", zap.Error(err))
+		}
+
+		pinger.OnPing(allocator.Observe)
+	}
+
+	metrics.RegisterMonitor()
+	serveMetrics(context.Background(), cfg.GetMetricsAddr())
+
 	// Startup delay before the first ping (initial-delay)
 	logger.Info("Starting up...")
 	time.Sleep(cfg.GetInitialDelay())
@@ -147,3 +224,10 @@ type ProcessStopped struct{}
 func (e *ProcessStopped) Error() string {
 	return "process stopped"
 }
+
+// Checks if a feature that observes the pings of the health checks is configured
+func usesPlayerCounts(cfg config.MonitorConfig) bool {
+	return cfg.GetPlayerTracking() != config.NoPlayerTracking || cfg.GetIdleTimeout() > 0 ||
+		len(cfg.GetMetadataLabels()) > 0 || len(cfg.GetMetadataAnnotations()) > 0 ||
+		cfg.GetAutoAllocate() || cfg.GetMaintenanceCron() != ""
+}
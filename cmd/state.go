@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"sync"
+
+	coresdk "agones.dev/agones/pkg/sdk"
+	sdk "agones.dev/agones/sdks/go"
+)
+
+// Agones GameServer states
+const (
+	readyState     = "Ready"
+	allocatedState = "Allocated"
+	shutdownState  = "Shutdown"
+)
+
+// Latest state of the GameServer, kept up to date with WatchGameServer
+type gameServerState struct {
+	mu    sync.Mutex
+	state string
+}
+
+func watchGameServerState(s *sdk.SDK) (*gameServerState, error) {
+	st := &gameServerState{}
+	err := s.WatchGameServer(func(gs *coresdk.GameServer) {
+		st.mu.Lock()
+		st.state = gs.GetStatus().GetState()
+		st.mu.Unlock()
+	})
+
+	return st, err
+}
+
+// Returns the last state seen, empty before the first update
+func (s *gameServerState) Get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
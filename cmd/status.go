@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	sdk "agones.dev/agones/sdks/go"
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+)
+
+// GameServer annotations and labels set after every backup. The Agones SDK prefixes the keys with agones.dev/sdk-
+const (
+	// Name, time and size of the last successful backup
+	lastBackupAnnotation     = "last-backup"
+	lastBackupTimeAnnotation = "last-backup-time"
+	lastBackupSizeAnnotation = "last-backup-size"
+
+	// Status of the last backup attempt and its error
+	backupStatusAnnotation = "backup-status"
+	backupErrorAnnotation  = "backup-error"
+	backupStatusLabel      = "backup-status"
+)
+
+const (
+	backupSucceeded = "succeeded"
+	backupFailed    = "failed"
+)
+
+// Max length of the error annotation in bytes
+const maxErrorLength = 256
+
+// Sets GameServer metadata. Implemented by the Agones SDK
+type metadataSetter interface {
+	SetAnnotation(key, value string) error
+	SetLabel(key, value string) error
+}
+
+// Publishes the outcome of backups to the GameServer's annotations and labels
+type backupStatus struct {
+	sdk metadataSetter
+}
+
+// Connects to the Agones SDK server when BACKUP_PUBLISH_STATUS is set. Returns nil if it is disabled or the SDK server can't be reached
+func newBackupStatus(cfg config.BackupConfig) *backupStatus {
+	if !cfg.GetBackupPublishStatus() {
+		return nil
+	}
+
+	s, err := sdk.NewSDK()
+	if err != nil {
+		logger.Warn("error connecting to the Agones SDK server. backup status will not be published", zap.Error(err))
+		return nil
+	}
+
+	return &backupStatus{s}
+}
+
+// Records a backup attempt. Successful backups update the last backup annotations, failed ones keep them so they still
+// point at the last usable backup. Errors are logged since a backup shouldn't fail because its status can't be published
+func (s *backupStatus) Publish(result backupResult, backupErr error) {
+	if s == nil {
+		return
+	}
+
+	var errs []error
+	annotate := func(key, value string) {
+		errs = append(errs, s.sdk.SetAnnotation(key, value))
+	}
+
+	if backupErr != nil {
+		msg := backupErr.Error()
+		if len(msg) > maxErrorLength {
+			// cut at a rune boundary so the annotation stays valid UTF-8
+			end := maxErrorLength
+			for end > 0 && !utf8.RuneStart(msg[end]) {
+				end--
+			}
+			msg = msg[:end]
+		}
+
+		annotate(backupStatusAnnotation, backupFailed)
+		annotate(backupErrorAnnotation, msg)
+		errs = append(errs, s.sdk.SetLabel(backupStatusLabel, backupFailed))
+	} else {
+		annotate(lastBackupAnnotation, result.Name)
+		annotate(lastBackupTimeAnnotation, result.Created.UTC().Format(time.RFC3339))
+		annotate(lastBackupSizeAnnotation, strconv.FormatInt(result.Size, 10))
+		annotate(backupStatusAnnotation, backupSucceeded)
+		annotate(backupErrorAnnotation, "")
+		errs = append(errs, s.sdk.SetLabel(backupStatusLabel, backupSucceeded))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		logger.Warn("error publishing backup status", zap.Error(err))
+	}
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Records the metadata set through the Agones SDK
+type fakeSDK struct {
+	annotations map[string]string
+	labels      map[string]string
+	err         error
+}
+
+func newFakeSDK(err error) *fakeSDK {
+	return &fakeSDK{map[string]string{}, map[string]string{}, err}
+}
+
+func (s *fakeSDK) SetAnnotation(key, value string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.annotations[key] = value
+	return nil
+}
+
+func (s *fakeSDK) SetLabel(key, value string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.labels[key] = value
+	return nil
+}
+
+func TestBackupStatusPublish(t *testing.T) {
+	created := time.Date(2021, 5, 9, 3, 35, 0, 0, time.FixedZone("CEST", 2*60*60))
+	result := backupResult{Name: "mc-server-2021-05-09T01:35:00Z.zip", Created: created, Size: 1024}
+
+	s := newFakeSDK(nil)
+	status := &backupStatus{s}
+
+	status.Publish(result, nil)
+
+	want := map[string]string{
+		lastBackupAnnotation:     result.Name,
+		lastBackupTimeAnnotation: "2021-05-09T01:35:00Z",
+		lastBackupSizeAnnotation: "1024",
+		backupStatusAnnotation:   backupSucceeded,
+		backupErrorAnnotation:    "",
+	}
+	for key, value := range want {
+		if got, ok := s.annotations[key]; !ok || got != value {
+			t.Errorf("annotation %s = %q, want %q", key, got, value)
+		}
+	}
+	if got := s.labels[backupStatusLabel]; got != backupSucceeded {
+		t.Errorf("label %s = %q, want %q", backupStatusLabel, got, backupSucceeded)
+	}
+
+	// a failed backup keeps the last backup annotations
+	status.Publish(backupResult{}, errors.New(strings.Repeat("x", maxErrorLength+100)))
+
+	if got := s.annotations[backupStatusAnnotation]; got != backupFailed {
+		t.Errorf("annotation %s = %q, want %q", backupStatusAnnotation, got, backupFailed)
+	}
+	if got := s.annotations[backupErrorAnnotation]; got != strings.Repeat("x", maxErrorLength) {
+		t.Errorf("annotation %s has %d characters, want %d", backupErrorAnnotation, len(got), maxErrorLength)
+	}
+	if got := s.labels[backupStatusLabel]; got != backupFailed {
+		t.Errorf("label %s = %q, want %q", backupStatusLabel, got, backupFailed)
+	}
+	if got := s.annotations[lastBackupAnnotation]; got != result.Name {
+		t.Errorf("annotation %s = %q after a failed backup, want %q", lastBackupAnnotation, got, result.Name)
+	}
+}
+
+func TestBackupStatusPublishTruncatesRunes(t *testing.T) {
+	s := newFakeSDK(nil)
+	status := &backupStatus{s}
+
+	// the multi-byte rune at the limit doesn't fit
+	msg := strings.Repeat("x", maxErrorLength-1) + "ä" + "rest"
+	status.Publish(backupResult{}, errors.New(msg))
+
+	got := s.annotations[backupErrorAnnotation]
+	if !utf8.ValidString(got) {
+		t.Errorf("annotation %s is not valid UTF-8: %q", backupErrorAnnotation, got)
+	}
+	if got != strings.Repeat("x", maxErrorLength-1) {
+		t.Errorf("annotation %s = %q, want the text before the cut rune", backupErrorAnnotation, got)
+	}
+}
+
+func TestBackupStatusPublishSDKError(t *testing.T) {
+	core, logs := observer.New(zapcore.WarnLevel)
+	defer func(l *zap.Logger) { logger = l }(logger)
+	logger = zap.New(core)
+
+	status := &backupStatus{newFakeSDK(errors.New("sdk server unavailable"))}
+	status.Publish(backupResult{Name: "mc-server.zip"}, nil)
+
+	if n := logs.FilterMessage("error publishing backup status").Len(); n != 1 {
+		t.Errorf("logged %d status errors, want 1", n)
+	}
+}
+
+func TestBackupStatusPublishDisabled(t *testing.T) {
+	// newBackupStatus returns nil when publishing is disabled
+	var status *backupStatus
+	status.Publish(backupResult{}, errors.New("backup failed"))
+}
@@ -0,0 +1,162 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/backup"
+	"github.com/raefon/agones-mc/pkg/backup/azure"
+	"github.com/raefon/agones-mc/pkg/backup/crypt"
+	"github.com/raefon/agones-mc/pkg/backup/google"
+	"github.com/raefon/agones-mc/pkg/backup/local"
+	"github.com/raefon/agones-mc/pkg/backup/oci"
+	"github.com/raefon/agones-mc/pkg/backup/s3"
+	"github.com/raefon/agones-mc/pkg/backup/throttle"
+	"github.com/raefon/agones-mc/pkg/backup/web"
+)
+
+// Creates a backup client for the storage backend selected by STORAGE_BACKEND.
+// Objects are encrypted and decrypted with the configured keys and transfers are limited to TRANSFER_BANDWIDTH_LIMIT
+func newBackupClient(ctx context.Context, cfg config.StorageConfig) (backup.BackupClient, error) {
+	client, err := newStorageClient(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return withEncryption(withBandwidthLimit(ctx, client, cfg), cfg)
+}
+
+// Creates a read-only client for a backup source URL and returns the name of the backup in it.
+// A name ending in a slash refers to a prefix or directory. Only dir sources, e.g. of directory layers, may have no name
+// and refer to the whole bucket or directory. Supports gs://bucket/name, s3://bucket/name, file:///path, http(s):// URLs
+// and oci://registry/name:tag artifacts
+func newSourceClient(ctx context.Context, cfg config.LoadConfig, source string, dir bool) (backup.BackupClient, string, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var client backup.BackupClient
+	name := strings.TrimPrefix(u.Path, "/")
+
+	switch u.Scheme {
+	case "gs":
+		client, err = google.New(ctx, u.Host, transferOptions(cfg))
+	case "s3":
+		client, err = s3.New(ctx, u.Host, s3Options(cfg))
+	case "file":
+		// a trailing slash refers to the directory itself
+		var dir string
+		dir, name = path.Split(u.Path)
+		client, err = local.Open(dir)
+	case "http", "https":
+		client, err = web.New(ctx, transferOptions(cfg))
+		name = source
+	case "oci":
+		var repository string
+		repository, name, err = oci.ParseReference(strings.TrimPrefix(source, "oci://"))
+		if err != nil {
+			return nil, "", err
+		}
+
+		client, err = oci.New(ctx, repository, oci.Options{
+			Username:  cfg.GetOCIUsername(),
+			Password:  cfg.GetOCIPassword(),
+			PlainHTTP: cfg.GetOCIPlainHTTP(),
+		})
+	default:
+		return nil, "", fmt.Errorf("unsupported backup source %q", u.Scheme)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	// a source URL with a typo shouldn't look like a missing backup and start a new world
+	if name == "" && !dir {
+		client.Close()
+		return nil, "", fmt.Errorf("backup source %q has no object name", source)
+	}
+
+	client, err = withEncryption(withBandwidthLimit(ctx, client, cfg), cfg)
+	return client, name, err
+}
+
+// Checks if a backup name is a source URL rather than an object name in the configured storage backend
+func isSourceURL(name string) bool {
+	return strings.Contains(name, "://")
+}
+
+// Wraps client to encrypt and decrypt objects with the configured keys
+func withEncryption(client backup.BackupClient, cfg config.StorageConfig) (backup.BackupClient, error) {
+	encrypted, err := crypt.New(client, crypt.Options{
+		Passphrase:     cfg.GetEncryptionPassphrase(),
+		Recipients:     cfg.GetEncryptionRecipients(),
+		RecipientsFile: cfg.GetEncryptionRecipientsFile(),
+		Identities:     cfg.GetEncryptionIdentities(),
+		IdentityFile:   cfg.GetEncryptionIdentityFile(),
+	})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("invalid encryption config: %w", err)
+	}
+
+	return encrypted, nil
+}
+
+func newStorageClient(ctx context.Context, cfg config.StorageConfig) (backup.BackupClient, error) {
+	switch cfg.GetStorageBackend() {
+	case config.GCSBackend:
+		return google.New(ctx, cfg.GetBucketName(), transferOptions(cfg))
+	case config.S3Backend:
+		return s3.New(ctx, cfg.GetBucketName(), s3Options(cfg))
+	case config.AzureBackend:
+		return azure.New(ctx, cfg.GetBucketName(), azure.Options{
+			ConnectionString: cfg.GetAzureConnectionString(),
+			Account:          cfg.GetAzureAccount(),
+			Key:              cfg.GetAzureKey(),
+			Endpoint:         cfg.GetAzureEndpoint(),
+			Transfer:         transferOptions(cfg),
+		})
+	case config.LocalBackend:
+		return local.New(cfg.GetBucketName())
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.GetStorageBackend())
+	}
+}
+
+func s3Options(cfg config.StorageConfig) s3.Options {
+	return s3.Options{
+		Endpoint:         cfg.GetS3Endpoint(),
+		Region:           cfg.GetS3Region(),
+		AccessKeyID:      cfg.GetS3AccessKeyID(),
+		SecretAccessKey:  cfg.GetS3SecretAccessKey(),
+		Insecure:         cfg.GetS3Insecure(),
+		DisableMultipart: cfg.GetS3DisableMultipart(),
+		Transfer:         transferOptions(cfg),
+	}
+}
+
+func transferOptions(cfg config.StorageConfig) backup.TransferOptions {
+	return backup.TransferOptions{
+		Timeout:     cfg.GetTransferTimeout(),
+		Retries:     cfg.GetTransferRetries(),
+		Backoff:     cfg.GetTransferBackoff(),
+		ChunkSize:   cfg.GetTransferChunkSize(),
+		Concurrency: cfg.GetTransferConcurrency(),
+	}
+}
+
+// Limits the bandwidth of uploads and downloads when TRANSFER_BANDWIDTH_LIMIT is set
+func withBandwidthLimit(ctx context.Context, client backup.BackupClient, cfg config.StorageConfig) backup.BackupClient {
+	limit := cfg.GetTransferBandwidthLimit()
+	if limit <= 0 {
+		return client
+	}
+
+	return throttle.New(ctx, client, limit)
+}
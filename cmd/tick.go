@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/metrics"
+	"github.com/raefon/agones-mc/pkg/ping"
+	"github.com/raefon/agones-mc/pkg/tick"
+)
+
+// GameServer metadata keys of the tick rate. The Agones SDK prefixes the keys with agones.dev/sdk-
+const (
+	tpsAnnotation     = "mc-tps"
+	msptAnnotation    = "mc-mspt"
+	laggingAnnotation = "mc-lagging"
+	laggingLabel      = "mc-lagging"
+)
+
+// Name of the health check added by LAG_ACTION=unhealthy
+const lagCheck = "tps"
+
+// Queries the server's tick rate every TPS_INTERVAL and compares it to the lag thresholds
+type tickMonitor struct {
+	cfg       config.MonitorConfig
+	querier   *tick.Querier
+	publisher *metadataPublisher
+
+	mu      sync.Mutex
+	stats   tick.Stats
+	lagging bool
+}
+
+// Creates a tick rate monitor that publishes the tick rate through the Agones SDK
+func newTickMonitor(cfg config.MonitorConfig, s metadataSetter) (*tickMonitor, error) {
+	switch action := cfg.GetLagAction(); action {
+	case config.NoLagAction, config.LabelLagAction, config.UnhealthyLagAction:
+	default:
+		return nil, fmt.Errorf("unknown lag action %q. must be none, label or unhealthy", action)
+	}
+
+	querier := &tick.Querier{
+		Host:     cfg.GetHost(),
+		Port:     cfg.GetRCONPort(),
+		Password: cfg.GetRCONPassword(),
+		Command:  cfg.GetTPSCommand(),
+		Timeout:  cfg.GetTimeout(),
+	}
+
+	return &tickMonitor{cfg: cfg, querier: querier, publisher: newMetadataPublisher(s)}, nil
+}
+
+// Queries the tick rate until ctx is done
+func (m *tickMonitor) Run(ctx context.Context) {
+	// RCON isn't up before the server has started
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(m.cfg.GetInitialDelay()):
+	}
+
+	ticker := time.NewTicker(m.cfg.GetTPSInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.query()
+		}
+	}
+}
+
+func (m *tickMonitor) query() {
+	stats, err := m.querier.Query()
+	if err != nil {
+		logger.Warn("error querying tick rate", zap.Error(err))
+		return
+	}
+
+	lagging := m.isLagging(stats)
+
+	m.mu.Lock()
+	wasLagging := m.lagging
+	m.stats, m.lagging = stats, lagging
+	m.mu.Unlock()
+
+	if lagging != wasLagging {
+		logger.Info("tick rate changed", zap.Bool("lagging", lagging), zap.Float64("tps", stats.TPS), zap.Float64("mspt", stats.MSPT))
+	}
+
+	metrics.ObserveTick(stats.TPS, stats.MSPT, lagging)
+
+	// rounded so small fluctuations don't update the GameServer on every query
+	if stats.TPS > 0 {
+		m.publisher.Annotation(tpsAnnotation, strconv.FormatFloat(stats.TPS, 'f', 1, 64))
+	}
+	if stats.MSPT > 0 {
+		m.publisher.Annotation(msptAnnotation, strconv.FormatFloat(stats.MSPT, 'f', 0, 64))
+	}
+
+	if m.hasThresholds() {
+		m.publisher.Annotation(laggingAnnotation, strconv.FormatBool(lagging))
+		if m.cfg.GetLagAction() == config.LabelLagAction {
+			m.publisher.Label(laggingLabel, strconv.FormatBool(lagging))
+		}
+	}
+}
+
+func (m *tickMonitor) hasThresholds() bool {
+	return m.cfg.GetTPSMin() > 0 || m.cfg.GetMSPTMax() > 0
+}
+
+// Checks the stats against TPS_MIN and MSPT_MAX. Unknown values don't count as lag
+func (m *tickMonitor) isLagging(stats tick.Stats) bool {
+	if min := m.cfg.GetTPSMin(); min > 0 && stats.TPS > 0 && stats.TPS < min {
+		return true
+	}
+
+	if max := m.cfg.GetMSPTMax(); max > 0 && stats.MSPT > max {
+		return true
+	}
+
+	return false
+}
+
+// Health check that fails while the server is lagging
+func (m *tickMonitor) check() ping.Pinger {
+	return &lagPinger{m}
+}
+
+type lagPinger struct {
+	m *tickMonitor
+}
+
+func (p *lagPinger) Ping() (*ping.ServerInfo, error) {
+	p.m.mu.Lock()
+	defer p.m.mu.Unlock()
+
+	if p.m.lagging {
+		return nil, fmt.Errorf("server lagging: %.1f TPS, %.0f MSPT", p.m.stats.TPS, p.m.stats.MSPT)
+	}
+
+	return &ping.ServerInfo{}, nil
+}
+
+func (p *lagPinger) PingWithTimeout() (*ping.ServerInfo, error) {
+	return p.Ping()
+}
+
+func (p *lagPinger) IsTimeoutZero() bool {
+	return false
+}
+
+func (p *lagPinger) ReportsPlayers() bool {
+	return false
+}
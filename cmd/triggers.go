@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	coresdk "agones.dev/agones/pkg/sdk"
+	sdk "agones.dev/agones/sdks/go"
+	"go.uber.org/zap"
+
+	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/ping"
+)
+
+// Reasons a backup was triggered
+const (
+	cronTrigger     = "cron"
+	shutdownTrigger = "shutdown"
+	emptyTrigger    = "players left"
+	activeTrigger   = "players online"
+	httpTrigger     = "http"
+)
+
+// Runs the backups requested by the triggers one at a time. A backup requested while another one is queued is merged into it
+type backupRunner struct {
+	cfg      config.BackupConfig
+	status   *backupStatus
+	requests chan string
+	// runs a backup. RunBackup outside of tests
+	backup func(config.BackupConfig) (backupResult, error)
+
+	mu sync.Mutex
+	// reason of the last completed backup
+	last string
+	// waiting for the result of the next backup to start
+	waiters []chan error
+}
+
+func newBackupRunner(cfg config.BackupConfig, status *backupStatus) *backupRunner {
+	return &backupRunner{cfg: cfg, status: status, requests: make(chan string, 1), backup: RunBackup}
+}
+
+// Requests a backup. Returns false if a backup is already queued
+func (r *backupRunner) Trigger(reason string) bool {
+	select {
+	case r.requests <- reason:
+		logger.Info("backup triggered", zap.String("trigger", reason))
+		return true
+	default:
+		return false
+	}
+}
+
+// Requests a backup and waits for it. Returns the error of the backup, or of ctx if it is done first
+func (r *backupRunner) TriggerAndWait(ctx context.Context, reason string) error {
+	done := make(chan error, 1)
+
+	r.mu.Lock()
+	r.waiters = append(r.waiters, done)
+	r.mu.Unlock()
+
+	// a backup that is already queued hasn't started yet, so it also picks up this waiter
+	r.Trigger(reason)
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Runs requested backups until ctx is done. A running backup is finished before returning
+func (r *backupRunner) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case reason := <-r.requests:
+			// waiters added from here on wait for the next backup, since this one may have missed their changes
+			r.mu.Lock()
+			waiters := r.waiters
+			r.waiters = nil
+			r.mu.Unlock()
+
+			result, err := r.backup(r.cfg)
+			r.status.Publish(result, err)
+
+			for _, done := range waiters {
+				done <- err
+			}
+
+			if err != nil {
+				logger.Error("backup failed", zap.String("serverName", r.cfg.GetPodName()), zap.String("trigger", reason), zap.Error(err))
+				continue
+			}
+
+			logger.Info("backup successful", zap.String("serverName", r.cfg.GetPodName()), zap.String("trigger", reason))
+
+			r.mu.Lock()
+			r.last = reason
+			r.mu.Unlock()
+		}
+	}
+}
+
+// Returns the trigger of the last successful backup
+func (r *backupRunner) Last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Checks if any trigger other than the cron schedule is configured
+func hasEventTriggers(cfg config.BackupConfig) bool {
+	return cfg.GetBackupOnShutdown() || cfg.GetBackupOnEmpty() || cfg.GetBackupActiveInterval() > 0 || cfg.GetBackupHTTPAddr() != ""
+}
+
+// Starts the configured event triggers. They stop when ctx is done
+func startTriggers(ctx context.Context, cfg config.BackupConfig, runner *backupRunner) error {
+	if cfg.GetBackupOnShutdown() {
+		if err := watchShutdown(runner); err != nil {
+			return err
+		}
+	}
+
+	if cfg.GetBackupOnEmpty() || cfg.GetBackupActiveInterval() > 0 {
+		go watchPlayers(ctx, cfg, runner)
+	}
+
+	if addr := cfg.GetBackupHTTPAddr(); addr != "" {
+		serveBackupTrigger(ctx, addr, runner)
+	}
+
+	return nil
+}
+
+// Backs up once the GameServer moves to the Shutdown state
+func watchShutdown(runner *backupRunner) error {
+	s, err := sdk.NewSDK()
+	if err != nil {
+		return err
+	}
+
+	var once sync.Once
+	return s.WatchGameServer(func(gs *coresdk.GameServer) {
+		if gs.GetStatus().GetState() == shutdownState {
+			once.Do(func() {
+				runner.Trigger(shutdownTrigger)
+			})
+		}
+	})
+}
+
+// Polls the player count of the server. Backs up after the last player leaves and every BACKUP_ACTIVE_INTERVAL
+// while players are online. Servers that stay empty are not backed up
+func watchPlayers(ctx context.Context, cfg config.BackupConfig, runner *backupRunner) {
+	pinger := newPinger(cfg)
+
+	poll := time.NewTicker(cfg.GetBackupPollInterval())
+	defer poll.Stop()
+
+	// never fires when the interval is not set
+	var active <-chan time.Time
+	if interval := cfg.GetBackupActiveInterval(); interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		active = ticker.C
+	}
+
+	var online int32
+	// players were online at some point since the last interval backup
+	seen := false
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-poll.C:
+			info, err := pinger.PingWithTimeout()
+			if err != nil {
+				logger.Debug("error pinging server for its player count", zap.Error(err))
+				continue
+			}
+
+			if online > 0 && info.OnlinePlayers == 0 && cfg.GetBackupOnEmpty() {
+				runner.Trigger(emptyTrigger)
+			}
+
+			online = info.OnlinePlayers
+			if online > 0 {
+				seen = true
+			}
+		case <-active:
+			if seen {
+				runner.Trigger(activeTrigger)
+			}
+			seen = online > 0
+		}
+	}
+}
+
+// Serves POST /backup to trigger a backup on demand
+func serveBackupTrigger(ctx context.Context, addr string, runner *backupRunner) {
+	server := &http.Server{Addr: addr, Handler: backupTriggerHandler(runner)}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	go func() {
+		logger.Info("serving backup trigger", zap.String("addr", addr))
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("backup trigger server error", zap.Error(err))
+		}
+	}()
+}
+
+// Handles POST /backup. With ?wait=true the response is sent once the backup is done
+func backupTriggerHandler(runner *backupRunner) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/backup", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(rw, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if wait, _ := strconv.ParseBool(r.URL.Query().Get("wait")); wait {
+			if err := runner.TriggerAndWait(r.Context(), httpTrigger); err != nil {
+				http.Error(rw, "backup failed: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			rw.Write([]byte("backup successful\n"))
+			return
+		}
+
+		msg := "backup queued\n"
+		if !runner.Trigger(httpTrigger) {
+			msg = "backup already queued\n"
+		}
+
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write([]byte(msg))
+	})
+
+	return mux
+}
+
+// Creates a pinger for the server's edition
+func newPinger(cfg config.ServerConfig) ping.Pinger {
+	if cfg.GetEdition() == config.BedrockEdition {
+		return &ping.BedrockPinger{Host: cfg.GetHost(), Port: uint16(cfg.GetPort()), Timeout: ping.DefaultTimeout}
+	}
+	return &ping.McPinger{Host: cfg.GetHost(), Port: uint16(cfg.GetPort()), Timeout: ping.DefaultTimeout}
+}
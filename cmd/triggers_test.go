@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raefon/agones-mc/internal/config"
+)
+
+// Starts a runner whose backups return err, and a backup trigger server for it
+func startTrigger(t *testing.T, err error) (*backupRunner, *httptest.Server) {
+	t.Helper()
+
+	runner := newBackupRunner(config.NewBackupConfig(), nil)
+	runner.backup = func(config.BackupConfig) (backupResult, error) {
+		return backupResult{Name: "server-1"}, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go runner.Run(ctx)
+
+	server := httptest.NewServer(backupTriggerHandler(runner))
+	t.Cleanup(server.Close)
+
+	return runner, server
+}
+
+func TestBackupTriggerWait(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{"success", nil, http.StatusOK, "backup successful"},
+		{"failure", errors.New("bucket not found"), http.StatusInternalServerError, "backup failed: bucket not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, server := startTrigger(t, tt.err)
+			client := &http.Client{Timeout: 5 * time.Second}
+
+			// the second request checks that waiters of earlier backups were removed
+			for i := 0; i < 2; i++ {
+				res, err := client.Post(server.URL+"/backup?wait=true", "", nil)
+				if err != nil {
+					t.Fatalf("request %d: %v", i, err)
+				}
+
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+
+				if res.StatusCode != tt.wantCode {
+					t.Errorf("request %d: status = %d, want %d", i, res.StatusCode, tt.wantCode)
+				}
+				if got := strings.TrimSpace(string(body)); got != tt.wantBody {
+					t.Errorf("request %d: body = %q, want %q", i, got, tt.wantBody)
+				}
+
+				runner.mu.Lock()
+				waiters := len(runner.waiters)
+				runner.mu.Unlock()
+
+				if waiters != 0 {
+					t.Errorf("request %d: %d waiters left after the backup", i, waiters)
+				}
+			}
+		})
+	}
+}
+
+func TestBackupTriggerQueue(t *testing.T) {
+	_, server := startTrigger(t, nil)
+
+	res, err := http.Post(server.URL+"/backup", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want %d", res.StatusCode, http.StatusAccepted)
+	}
+
+	res, err = http.Get(server.URL + "/backup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET status = %d, want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestTriggerBackup(t *testing.T) {
+	_, server := startTrigger(t, nil)
+	if err := triggerBackup(server.URL + "/backup?wait=true"); err != nil {
+		t.Errorf("triggerBackup() = %v", err)
+	}
+
+	_, server = startTrigger(t, errors.New("upload failed"))
+	err := triggerBackup(server.URL + "/backup?wait=true")
+	if err == nil || !strings.Contains(err.Error(), "upload failed") {
+		t.Errorf("triggerBackup() = %v, want the backup error", err)
+	}
+}
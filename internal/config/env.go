@@ -1,6 +1,8 @@
 package config
 
 import (
+	"path"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -9,6 +11,12 @@ import (
 type Edition string
 type Environment string
 type Subcommand string
+type StorageBackend string
+type BackupMode string
+type LoadMode string
+type ExistingWorld string
+type PlayerTracking string
+type LagAction string
 
 const (
 	// subcommands
@@ -28,6 +36,40 @@ const (
 
 	Development Environment = "development"
 	Production  Environment = "production"
+
+	// storage backend
+
+	GCSBackend   StorageBackend = "gcs"
+	S3Backend    StorageBackend = "s3"
+	AzureBackend StorageBackend = "azure"
+	LocalBackend StorageBackend = "local"
+
+	// backup mode
+
+	FullBackup        BackupMode = "full"
+	IncrementalBackup BackupMode = "incremental"
+
+	// load mode
+
+	ExtractLoad  LoadMode = "extract"
+	DownloadLoad LoadMode = "download"
+
+	// existing world
+
+	PreserveWorld ExistingWorld = "preserve"
+	WipeWorld     ExistingWorld = "wipe"
+
+	// player tracking
+
+	NoPlayerTracking      PlayerTracking = "none"
+	CounterPlayerTracking PlayerTracking = "counters"
+	AlphaPlayerTracking   PlayerTracking = "alpha"
+
+	// lag action
+
+	NoLagAction        LagAction = "none"
+	LabelLagAction     LagAction = "label"
+	UnhealthyLagAction LagAction = "unhealthy"
 )
 
 const (
@@ -35,6 +77,7 @@ const (
 
 	ENVIRONMENT   string = "ENVIRONMENT"
 	INITIAL_DELAY string = "INITIAL_DELAY"
+	METRICS_ADDR  string = "METRICS_ADDR"
 
 	// server config
 
@@ -52,11 +95,125 @@ const (
 	INTERVAL     string = "INTERVAL"
 	TIMEOUT      string = "TIMEOUT"
 
+	// health check config
+
+	READY_CHECKS       string = "READY_CHECKS"
+	HEALTH_CHECKS      string = "HEALTH_CHECKS"
+	QUERY_PORT         string = "QUERY_PORT"
+	RCON_CHECK_COMMAND string = "RCON_CHECK_COMMAND"
+
+	// tick rate config
+
+	TPS_INTERVAL string = "TPS_INTERVAL"
+	TPS_COMMAND  string = "TPS_COMMAND"
+	TPS_MIN      string = "TPS_MIN"
+	MSPT_MAX     string = "MSPT_MAX"
+	LAG_ACTION   string = "LAG_ACTION"
+
+	// player tracking config
+
+	PLAYER_TRACKING string = "PLAYER_TRACKING"
+	PLAYER_COUNTER  string = "PLAYER_COUNTER"
+	PLAYER_LIST     string = "PLAYER_LIST"
+
+	// idle shutdown config
+
+	IDLE_TIMEOUT        string = "IDLE_TIMEOUT"
+	IDLE_ONLY_ALLOCATED string = "IDLE_ONLY_ALLOCATED"
+	IDLE_WARNING        string = "IDLE_WARNING"
+	IDLE_GRACE_PERIOD   string = "IDLE_GRACE_PERIOD"
+	IDLE_BACKUP_URL     string = "IDLE_BACKUP_URL"
+
+	// server metadata config
+
+	METADATA_LABELS      string = "METADATA_LABELS"
+	METADATA_ANNOTATIONS string = "METADATA_ANNOTATIONS"
+
+	// allocation config
+
+	AUTO_ALLOCATE        string = "AUTO_ALLOCATE"
+	MAINTENANCE_CRON     string = "MAINTENANCE_CRON"
+	MAINTENANCE_DURATION string = "MAINTENANCE_DURATION"
+
 	// backup config
 
-	BUCKET_NAME string = "BUCKET_NAME"
-	BACKUP_CRON string = "BACKUP_CRON"
-	BACKUP_NAME string = "BACKUP_NAME"
+	BUCKET_NAME       string = "BUCKET_NAME"
+	BACKUP_CRON       string = "BACKUP_CRON"
+	BACKUP_NAME       string = "BACKUP_NAME"
+	SAVE_TIMEOUT      string = "SAVE_TIMEOUT"
+	BACKUP_MODE       string = "BACKUP_MODE"
+	BACKUP_SPOOL      string = "BACKUP_SPOOL"
+	ARCHIVE_FORMAT    string = "ARCHIVE_FORMAT"
+	COMPRESSION_LEVEL string = "COMPRESSION_LEVEL"
+	BACKUP_INCLUDE    string = "BACKUP_INCLUDE"
+	BACKUP_EXCLUDE    string = "BACKUP_EXCLUDE"
+
+	// backup trigger config
+
+	BACKUP_ON_SHUTDOWN     string = "BACKUP_ON_SHUTDOWN"
+	BACKUP_ON_EMPTY        string = "BACKUP_ON_EMPTY"
+	BACKUP_ACTIVE_INTERVAL string = "BACKUP_ACTIVE_INTERVAL"
+	BACKUP_POLL_INTERVAL   string = "BACKUP_POLL_INTERVAL"
+	BACKUP_HTTP_ADDR       string = "BACKUP_HTTP_ADDR"
+	BACKUP_PUBLISH_STATUS  string = "BACKUP_PUBLISH_STATUS"
+	BACKUP_HOOKS           string = "BACKUP_HOOKS"
+	BACKUP_HOOKS_FILE      string = "BACKUP_HOOKS_FILE"
+
+	// load config
+
+	BACKUP_PREFIX       string = "BACKUP_PREFIX"
+	BACKUP_BEFORE       string = "BACKUP_BEFORE"
+	BACKUP_SHA256       string = "BACKUP_SHA256"
+	OCI_USERNAME        string = "OCI_USERNAME"
+	OCI_PASSWORD        string = "OCI_PASSWORD"
+	OCI_PLAIN_HTTP      string = "OCI_PLAIN_HTTP"
+	LOAD_MODE           string = "LOAD_MODE"
+	LOAD_EXISTING_WORLD string = "LOAD_EXISTING_WORLD"
+	LOAD_INCLUDE        string = "LOAD_INCLUDE"
+	LOAD_EXCLUDE        string = "LOAD_EXCLUDE"
+	LEVEL_NAME          string = "LEVEL_NAME"
+	LOAD_LAYERS         string = "LOAD_LAYERS"
+	LOAD_LAYERS_FILE    string = "LOAD_LAYERS_FILE"
+
+	// retention config
+
+	RETENTION_KEEP_LAST    string = "RETENTION_KEEP_LAST"
+	RETENTION_KEEP_DAILY   string = "RETENTION_KEEP_DAILY"
+	RETENTION_KEEP_WEEKLY  string = "RETENTION_KEEP_WEEKLY"
+	RETENTION_KEEP_MONTHLY string = "RETENTION_KEEP_MONTHLY"
+	RETENTION_MAX_AGE      string = "RETENTION_MAX_AGE"
+	RETENTION_DRY_RUN      string = "RETENTION_DRY_RUN"
+
+	// storage config
+
+	STORAGE_BACKEND                 string = "STORAGE_BACKEND"
+	S3_ENDPOINT                     string = "S3_ENDPOINT"
+	S3_REGION                       string = "S3_REGION"
+	S3_ACCESS_KEY_ID                string = "S3_ACCESS_KEY_ID"
+	S3_SECRET_ACCESS_KEY            string = "S3_SECRET_ACCESS_KEY"
+	S3_INSECURE                     string = "S3_INSECURE"
+	S3_DISABLE_MULTIPART            string = "S3_DISABLE_MULTIPART"
+	AZURE_STORAGE_CONNECTION_STRING string = "AZURE_STORAGE_CONNECTION_STRING"
+	AZURE_STORAGE_ACCOUNT           string = "AZURE_STORAGE_ACCOUNT"
+	AZURE_STORAGE_KEY               string = "AZURE_STORAGE_KEY"
+	AZURE_STORAGE_ENDPOINT          string = "AZURE_STORAGE_ENDPOINT"
+
+	// encryption config
+
+	ENCRYPTION_PASSPHRASE      string = "ENCRYPTION_PASSPHRASE"
+	ENCRYPTION_RECIPIENTS      string = "ENCRYPTION_RECIPIENTS"
+	ENCRYPTION_RECIPIENTS_FILE string = "ENCRYPTION_RECIPIENTS_FILE"
+	ENCRYPTION_IDENTITY        string = "ENCRYPTION_IDENTITY"
+	ENCRYPTION_IDENTITY_FILE   string = "ENCRYPTION_IDENTITY_FILE"
+
+	// transfer config
+
+	TRANSFER_TIMEOUT         string = "TRANSFER_TIMEOUT"
+	TRANSFER_RETRIES         string = "TRANSFER_RETRIES"
+	TRANSFER_BACKOFF         string = "TRANSFER_BACKOFF"
+	TRANSFER_CHUNK_SIZE_MIB  string = "TRANSFER_CHUNK_SIZE_MIB"
+	TRANSFER_CONCURRENCY     string = "TRANSFER_CONCURRENCY"
+	TRANSFER_BANDWIDTH_LIMIT string = "TRANSFER_BANDWIDTH_LIMIT"
 )
 
 var (
@@ -66,6 +223,7 @@ var (
 
 	ENVIRONMENT_DEFAULT   Environment   = Development
 	INITIAL_DELAY_DEFAULT time.Duration = time.Second * 30
+	METRICS_ADDR_DEFAULT  string        = ""
 
 	// server config
 
@@ -83,16 +241,141 @@ var (
 	INTERVAL_DEFAULT     time.Duration = time.Second * 10
 	TIMEOUT_DEFAULT      time.Duration = time.Second * 10
 
+	// health check config
+
+	READY_CHECKS_DEFAULT       string = "status"
+	HEALTH_CHECKS_DEFAULT      string = "status"
+	QUERY_PORT_DEFAULT         int    = 25565
+	RCON_CHECK_COMMAND_DEFAULT string = "list"
+
+	// tick rate config
+
+	TPS_INTERVAL_DEFAULT time.Duration = 0
+	TPS_COMMAND_DEFAULT  string        = "auto"
+	TPS_MIN_DEFAULT      float64       = 0
+	MSPT_MAX_DEFAULT     float64       = 0
+	LAG_ACTION_DEFAULT   string        = "label"
+
+	// player tracking config
+
+	PLAYER_TRACKING_DEFAULT string = "none"
+	PLAYER_COUNTER_DEFAULT  string = "players"
+	PLAYER_LIST_DEFAULT     string = ""
+
+	// idle shutdown config
+
+	IDLE_TIMEOUT_DEFAULT        time.Duration = 0
+	IDLE_ONLY_ALLOCATED_DEFAULT bool          = true
+	IDLE_WARNING_DEFAULT        string        = "say No players online. Shutting down the server"
+	IDLE_GRACE_PERIOD_DEFAULT   time.Duration = time.Second * 30
+	IDLE_BACKUP_URL_DEFAULT     string        = ""
+
+	// server metadata config
+
+	METADATA_LABELS_DEFAULT      string = ""
+	METADATA_ANNOTATIONS_DEFAULT string = ""
+
+	// allocation config
+
+	AUTO_ALLOCATE_DEFAULT        bool          = false
+	MAINTENANCE_CRON_DEFAULT     string        = ""
+	MAINTENANCE_DURATION_DEFAULT time.Duration = time.Hour
+
 	// backup config
 
-	BUCKET_NAME_DEFAULT string = ""
-	BACKUP_CRON_DEFAULT string = ""
-	BACKUP_NAME_DEFAULT string = ""
+	BUCKET_NAME_DEFAULT       string        = ""
+	BACKUP_CRON_DEFAULT       string        = ""
+	BACKUP_NAME_DEFAULT       string        = ""
+	SAVE_TIMEOUT_DEFAULT      time.Duration = time.Minute * 2
+	BACKUP_MODE_DEFAULT       string        = "full"
+	BACKUP_SPOOL_DEFAULT      bool          = false
+	ARCHIVE_FORMAT_DEFAULT    string        = "zip"
+	COMPRESSION_LEVEL_DEFAULT int           = -1
+	BACKUP_INCLUDE_DEFAULT    string        = ""
+	BACKUP_EXCLUDE_DEFAULT    string        = "**/session.lock"
+
+	// backup trigger config
+
+	BACKUP_ON_SHUTDOWN_DEFAULT     bool          = false
+	BACKUP_ON_EMPTY_DEFAULT        bool          = false
+	BACKUP_ACTIVE_INTERVAL_DEFAULT time.Duration = 0
+	BACKUP_POLL_INTERVAL_DEFAULT   time.Duration = time.Second * 30
+	BACKUP_HTTP_ADDR_DEFAULT       string        = ""
+	BACKUP_PUBLISH_STATUS_DEFAULT  bool          = true
+	BACKUP_HOOKS_DEFAULT           string        = ""
+	BACKUP_HOOKS_FILE_DEFAULT      string        = ""
+
+	// paths backed up when BACKUP_INCLUDE is not set. relative to VOLUME
+
+	JAVA_BACKUP_INCLUDE    = []string{"world", "world_nether", "world_the_end", "server.properties", "whitelist.json", "ops.json", "banned-players.json", "banned-ips.json", "plugins/**/*.yml", "plugins/**/*.yaml", "plugins/**/*.json", "plugins/**/*.toml", "config"}
+	BEDROCK_BACKUP_INCLUDE = []string{"worlds", "server.properties", "permissions.json", "allowlist.json", "whitelist.json"}
+
+	// load config
+
+	BACKUP_PREFIX_DEFAULT       string = ""
+	BACKUP_BEFORE_DEFAULT       string = ""
+	BACKUP_SHA256_DEFAULT       string = ""
+	OCI_USERNAME_DEFAULT        string = ""
+	OCI_PASSWORD_DEFAULT        string = ""
+	OCI_PLAIN_HTTP_DEFAULT      bool   = false
+	LOAD_MODE_DEFAULT           string = "extract"
+	LOAD_EXISTING_WORLD_DEFAULT string = "preserve"
+	LOAD_INCLUDE_DEFAULT        string = ""
+	LOAD_EXCLUDE_DEFAULT        string = ""
+	LEVEL_NAME_DEFAULT          string = ""
+	LOAD_LAYERS_DEFAULT         string = ""
+	LOAD_LAYERS_FILE_DEFAULT    string = ""
+
+	// world names used when LEVEL_NAME is not set
+
+	JAVA_LEVEL_NAME    = "world"
+	BEDROCK_LEVEL_NAME = "Bedrock level"
+
+	// retention config
+
+	RETENTION_KEEP_LAST_DEFAULT    int           = 0
+	RETENTION_KEEP_DAILY_DEFAULT   int           = 0
+	RETENTION_KEEP_WEEKLY_DEFAULT  int           = 0
+	RETENTION_KEEP_MONTHLY_DEFAULT int           = 0
+	RETENTION_MAX_AGE_DEFAULT      time.Duration = 0
+	RETENTION_DRY_RUN_DEFAULT      bool          = false
+
+	// storage config
+
+	STORAGE_BACKEND_DEFAULT                 string = "gcs"
+	S3_ENDPOINT_DEFAULT                     string = "s3.amazonaws.com"
+	S3_REGION_DEFAULT                       string = ""
+	S3_ACCESS_KEY_ID_DEFAULT                string = ""
+	S3_SECRET_ACCESS_KEY_DEFAULT            string = ""
+	S3_INSECURE_DEFAULT                     bool   = false
+	S3_DISABLE_MULTIPART_DEFAULT            bool   = false
+	AZURE_STORAGE_CONNECTION_STRING_DEFAULT string = ""
+	AZURE_STORAGE_ACCOUNT_DEFAULT           string = ""
+	AZURE_STORAGE_KEY_DEFAULT               string = ""
+	AZURE_STORAGE_ENDPOINT_DEFAULT          string = ""
+
+	// encryption config
+
+	ENCRYPTION_PASSPHRASE_DEFAULT      string = ""
+	ENCRYPTION_RECIPIENTS_DEFAULT      string = ""
+	ENCRYPTION_RECIPIENTS_FILE_DEFAULT string = ""
+	ENCRYPTION_IDENTITY_DEFAULT        string = ""
+	ENCRYPTION_IDENTITY_FILE_DEFAULT   string = ""
+
+	// transfer config
+
+	TRANSFER_TIMEOUT_DEFAULT         time.Duration = time.Minute * 2
+	TRANSFER_RETRIES_DEFAULT         int           = 5
+	TRANSFER_BACKOFF_DEFAULT         time.Duration = time.Second
+	TRANSFER_CHUNK_SIZE_MIB_DEFAULT  int           = 16
+	TRANSFER_CONCURRENCY_DEFAULT     int           = 4
+	TRANSFER_BANDWIDTH_LIMIT_DEFAULT int           = 0
 )
 
 type SharedConfig interface {
 	GetInitialDelay() time.Duration
 	GetEnvironment() Environment
+	GetMetricsAddr() string
 }
 
 type ServerConfig interface {
@@ -111,20 +394,109 @@ type MonitorConfig interface {
 	GetInterval() time.Duration
 	GetTimeout() time.Duration
 	GetAttempts() int
+	GetReadyChecks() []string
+	GetHealthChecks() []string
+	GetQueryPort() int
+	GetRCONCheckCommand() string
+	GetTPSInterval() time.Duration
+	GetTPSCommand() string
+	GetTPSMin() float64
+	GetMSPTMax() float64
+	GetLagAction() LagAction
+	GetPlayerTracking() PlayerTracking
+	GetPlayerCounter() string
+	GetPlayerList() string
+	GetIdleTimeout() time.Duration
+	GetIdleOnlyAllocated() bool
+	GetIdleWarning() string
+	GetIdleGracePeriod() time.Duration
+	GetIdleBackupURL() string
+	GetMetadataLabels() []string
+	GetMetadataAnnotations() []string
+	GetAutoAllocate() bool
+	GetMaintenanceCron() string
+	GetMaintenanceDuration() time.Duration
+}
+
+type StorageConfig interface {
+	GetStorageBackend() StorageBackend
+	GetBucketName() string
+	GetS3Endpoint() string
+	GetS3Region() string
+	GetS3AccessKeyID() string
+	GetS3SecretAccessKey() string
+	GetS3Insecure() bool
+	GetS3DisableMultipart() bool
+	GetAzureConnectionString() string
+	GetAzureAccount() string
+	GetAzureKey() string
+	GetAzureEndpoint() string
+	GetEncryptionPassphrase() string
+	GetEncryptionRecipients() []string
+	GetEncryptionRecipientsFile() string
+	GetEncryptionIdentities() []string
+	GetEncryptionIdentityFile() string
+	GetTransferTimeout() time.Duration
+	GetTransferRetries() int
+	GetTransferBackoff() time.Duration
+	GetTransferChunkSize() int64
+	GetTransferConcurrency() int
+	GetTransferBandwidthLimit() int
 }
 
 type BackupConfig interface {
 	SharedConfig
 	ServerConfig
-	GetBucketName() string
+	StorageConfig
 	GetBackupCron() string
+	GetSaveTimeout() time.Duration
+	GetBackupMode() BackupMode
+	GetBackupSpool() bool
+	GetArchiveFormat() string
+	GetCompressionLevel() int
+	GetBackupInclude() []string
+	GetBackupExclude() []string
+	GetBackupOnShutdown() bool
+	GetBackupOnEmpty() bool
+	GetBackupActiveInterval() time.Duration
+	GetBackupPollInterval() time.Duration
+	GetBackupHTTPAddr() string
+	GetBackupPublishStatus() bool
+	GetBackupHooks() string
+	GetBackupHooksFile() string
+	GetRetentionKeepLast() int
+	GetRetentionKeepDaily() int
+	GetRetentionKeepWeekly() int
+	GetRetentionKeepMonthly() int
+	GetRetentionMaxAge() time.Duration
+	GetRetentionDryRun() bool
 }
 
 type LoadConfig interface {
 	ServerConfig
 	ServerConfig
-	GetBucketName() string
+	StorageConfig
 	GetBackupName() string
+	GetBackupPrefix() string
+	GetBackupBefore() string
+	GetBackupSHA256() string
+	GetOCIUsername() string
+	GetOCIPassword() string
+	GetOCIPlainHTTP() bool
+	GetLoadMode() LoadMode
+	GetLoadExistingWorld() ExistingWorld
+	GetLoadInclude() []string
+	GetLoadExclude() []string
+	GetLoadLayers() string
+	GetLoadLayersFile() string
+	GetLevelName() string
+	GetWorldDir() string
+	GetWorldDirs() []string
+}
+
+type BackupsConfig interface {
+	ServerConfig
+	StorageConfig
 }
 
 type FileserverConfig interface {
@@ -145,6 +517,10 @@ func (sharedConfig) GetInitialDelay() time.Duration {
 	return viper.GetDuration(INITIAL_DELAY)
 }
 
+func (sharedConfig) GetMetricsAddr() string {
+	return viper.GetString(METRICS_ADDR)
+}
+
 type serverConfig struct{}
 
 func (serverConfig) GetHost() string {
@@ -175,6 +551,102 @@ func (serverConfig) GetPodName() string {
 	return viper.GetString(POD_NAME)
 }
 
+type storageConfig struct{}
+
+func (storageConfig) GetStorageBackend() StorageBackend {
+	return StorageBackend(viper.GetString(STORAGE_BACKEND))
+}
+
+func (storageConfig) GetBucketName() string {
+	return viper.GetString(BUCKET_NAME)
+}
+
+func (storageConfig) GetS3Endpoint() string {
+	return viper.GetString(S3_ENDPOINT)
+}
+
+func (storageConfig) GetS3Region() string {
+	return viper.GetString(S3_REGION)
+}
+
+func (storageConfig) GetS3AccessKeyID() string {
+	return viper.GetString(S3_ACCESS_KEY_ID)
+}
+
+func (storageConfig) GetS3SecretAccessKey() string {
+	return viper.GetString(S3_SECRET_ACCESS_KEY)
+}
+
+func (storageConfig) GetS3Insecure() bool {
+	return viper.GetBool(S3_INSECURE)
+}
+
+func (storageConfig) GetS3DisableMultipart() bool {
+	return viper.GetBool(S3_DISABLE_MULTIPART)
+}
+
+func (storageConfig) GetAzureConnectionString() string {
+	return viper.GetString(AZURE_STORAGE_CONNECTION_STRING)
+}
+
+func (storageConfig) GetAzureAccount() string {
+	return viper.GetString(AZURE_STORAGE_ACCOUNT)
+}
+
+func (storageConfig) GetAzureKey() string {
+	return viper.GetString(AZURE_STORAGE_KEY)
+}
+
+func (storageConfig) GetAzureEndpoint() string {
+	return viper.GetString(AZURE_STORAGE_ENDPOINT)
+}
+
+func (storageConfig) GetEncryptionPassphrase() string {
+	return viper.GetString(ENCRYPTION_PASSPHRASE)
+}
+
+func (storageConfig) GetEncryptionRecipients() []string {
+	return splitList(viper.GetString(ENCRYPTION_RECIPIENTS))
+}
+
+func (storageConfig) GetEncryptionRecipientsFile() string {
+	return viper.GetString(ENCRYPTION_RECIPIENTS_FILE)
+}
+
+func (storageConfig) GetEncryptionIdentities() []string {
+	return splitList(viper.GetString(ENCRYPTION_IDENTITY))
+}
+
+func (storageConfig) GetEncryptionIdentityFile() string {
+	return viper.GetString(ENCRYPTION_IDENTITY_FILE)
+}
+
+func (storageConfig) GetTransferTimeout() time.Duration {
+	return viper.GetDuration(TRANSFER_TIMEOUT)
+}
+
+func (storageConfig) GetTransferRetries() int {
+	return viper.GetInt(TRANSFER_RETRIES)
+}
+
+func (storageConfig) GetTransferBackoff() time.Duration {
+	return viper.GetDuration(TRANSFER_BACKOFF)
+}
+
+// Returns the chunk size in bytes
+func (storageConfig) GetTransferChunkSize() int64 {
+	return viper.GetInt64(TRANSFER_CHUNK_SIZE_MIB) << 20
+}
+
+func (storageConfig) GetTransferConcurrency() int {
+	return viper.GetInt(TRANSFER_CONCURRENCY)
+}
+
+// Returns the bandwidth limit in bytes per second. 0 means unlimited
+func (storageConfig) GetTransferBandwidthLimit() int {
+	return viper.GetInt(TRANSFER_BANDWIDTH_LIMIT) << 10
+}
+
 type monitorConfig struct {
 	sharedConfig
 	serverConfig
@@ -196,40 +668,300 @@ func (monitorConfig) GetAttempts() int {
 	return viper.GetInt(MAX_ATTEMPTS)
 }
 
+func (monitorConfig) GetReadyChecks() []string {
+	return splitList(viper.GetString(READY_CHECKS))
+}
+
+func (monitorConfig) GetHealthChecks() []string {
+	return splitList(viper.GetString(HEALTH_CHECKS))
+}
+
+func (monitorConfig) GetQueryPort() int {
+	return viper.GetInt(QUERY_PORT)
+}
+
+func (monitorConfig) GetRCONCheckCommand() string {
+	return viper.GetString(RCON_CHECK_COMMAND)
+}
+
+func (monitorConfig) GetTPSInterval() time.Duration {
+	return viper.GetDuration(TPS_INTERVAL)
+}
+
+func (monitorConfig) GetTPSCommand() string {
+	return viper.GetString(TPS_COMMAND)
+}
+
+func (monitorConfig) GetTPSMin() float64 {
+	return viper.GetFloat64(TPS_MIN)
+}
+
+func (monitorConfig) GetMSPTMax() float64 {
+	return viper.GetFloat64(MSPT_MAX)
+}
+
+func (monitorConfig) GetLagAction() LagAction {
+	return LagAction(viper.GetString(LAG_ACTION))
+}
+
+func (monitorConfig) GetPlayerTracking() PlayerTracking {
+	return PlayerTracking(viper.GetString(PLAYER_TRACKING))
+}
+
+func (monitorConfig) GetPlayerCounter() string {
+	return viper.GetString(PLAYER_COUNTER)
+}
+
+func (monitorConfig) GetPlayerList() string {
+	return viper.GetString(PLAYER_LIST)
+}
+
+func (monitorConfig) GetIdleTimeout() time.Duration {
+	return viper.GetDuration(IDLE_TIMEOUT)
+}
+
+func (monitorConfig) GetIdleOnlyAllocated() bool {
+	return viper.GetBool(IDLE_ONLY_ALLOCATED)
+}
+
+func (monitorConfig) GetIdleWarning() string {
+	return viper.GetString(IDLE_WARNING)
+}
+
+func (monitorConfig) GetIdleGracePeriod() time.Duration {
+	return viper.GetDuration(IDLE_GRACE_PERIOD)
+}
+
+func (monitorConfig) GetIdleBackupURL() string {
+	return viper.GetString(IDLE_BACKUP_URL)
+}
+
+func (monitorConfig) GetMetadataLabels() []string {
+	return splitList(viper.GetString(METADATA_LABELS))
+}
+
+func (monitorConfig) GetMetadataAnnotations() []string {
+	return splitList(viper.GetString(METADATA_ANNOTATIONS))
+}
+
+func (monitorConfig) GetAutoAllocate() bool {
+	return viper.GetBool(AUTO_ALLOCATE)
+}
+
+func (monitorConfig) GetMaintenanceCron() string {
+	return viper.GetString(MAINTENANCE_CRON)
+}
+
+func (monitorConfig) GetMaintenanceDuration() time.Duration {
+	return viper.GetDuration(MAINTENANCE_DURATION)
+}
+
 type backupConfig struct {
 	sharedConfig
 	serverConfig
+	storageConfig
 }
 
 func NewBackupConfig() backupConfig {
 	return backupConfig{}
 }
 
-func (backupConfig) GetBucketName() string {
-	return viper.GetString(BUCKET_NAME)
-}
-
 func (backupConfig) GetBackupCron() string {
 	return viper.GetString(BACKUP_CRON)
 }
 
+func (backupConfig) GetSaveTimeout() time.Duration {
+	return viper.GetDuration(SAVE_TIMEOUT)
+}
+
+func (backupConfig) GetBackupMode() BackupMode {
+	return BackupMode(viper.GetString(BACKUP_MODE))
+}
+
+func (backupConfig) GetBackupSpool() bool {
+	return viper.GetBool(BACKUP_SPOOL)
+}
+
+func (backupConfig) GetArchiveFormat() string {
+	return viper.GetString(ARCHIVE_FORMAT)
+}
+
+func (backupConfig) GetCompressionLevel() int {
+	return viper.GetInt(COMPRESSION_LEVEL)
+}
+
+// Returns the include globs. Defaults to the world dimensions and server config files of the edition
+func (c backupConfig) GetBackupInclude() []string {
+	if include := splitList(viper.GetString(BACKUP_INCLUDE)); len(include) > 0 {
+		return include
+	}
+
+	if c.GetEdition() == BedrockEdition {
+		return BEDROCK_BACKUP_INCLUDE
+	}
+	return JAVA_BACKUP_INCLUDE
+}
+
+func (backupConfig) GetBackupExclude() []string {
+	return splitList(viper.GetString(BACKUP_EXCLUDE))
+}
+
+func (backupConfig) GetBackupOnShutdown() bool {
+	return viper.GetBool(BACKUP_ON_SHUTDOWN)
+}
+
+func (backupConfig) GetBackupOnEmpty() bool {
+	return viper.GetBool(BACKUP_ON_EMPTY)
+}
+
+func (backupConfig) GetBackupActiveInterval() time.Duration {
+	return viper.GetDuration(BACKUP_ACTIVE_INTERVAL)
+}
+
+func (backupConfig) GetBackupPollInterval() time.Duration {
+	return viper.GetDuration(BACKUP_POLL_INTERVAL)
+}
+
+func (backupConfig) GetBackupHTTPAddr() string {
+	return viper.GetString(BACKUP_HTTP_ADDR)
+}
+
+func (backupConfig) GetBackupPublishStatus() bool {
+	return viper.GetBool(BACKUP_PUBLISH_STATUS)
+}
+
+func (backupConfig) GetBackupHooks() string {
+	return viper.GetString(BACKUP_HOOKS)
+}
+
+func (backupConfig) GetBackupHooksFile() string {
+	return viper.GetString(BACKUP_HOOKS_FILE)
+}
+
+func (backupConfig) GetRetentionKeepLast() int {
+	return viper.GetInt(RETENTION_KEEP_LAST)
+}
+
+func (backupConfig) GetRetentionKeepDaily() int {
+	return viper.GetInt(RETENTION_KEEP_DAILY)
+}
+
+func (backupConfig) GetRetentionKeepWeekly() int {
+	return viper.GetInt(RETENTION_KEEP_WEEKLY)
+}
+
+func (backupConfig) GetRetentionKeepMonthly() int {
+	return viper.GetInt(RETENTION_KEEP_MONTHLY)
+}
+
+func (backupConfig) GetRetentionMaxAge() time.Duration {
+	return viper.GetDuration(RETENTION_MAX_AGE)
+}
+
+func (backupConfig) GetRetentionDryRun() bool {
+	return viper.GetBool(RETENTION_DRY_RUN)
+}
+
 type loadConfig struct {
 	sharedConfig
 	serverConfig
+	storageConfig
 }
 
 func NewLoadConfig() loadConfig {
 	return loadConfig{}
 }
 
-func (loadConfig) GetBucketName() string {
-	return viper.GetString(BUCKET_NAME)
-}
-
 func (loadConfig) GetBackupName() string {
 	return viper.GetString(BACKUP_NAME)
 }
 
+func (loadConfig) GetBackupPrefix() string {
+	return viper.GetString(BACKUP_PREFIX)
+}
+
+func (loadConfig) GetBackupBefore() string {
+	return viper.GetString(BACKUP_BEFORE)
+}
+
+func (loadConfig) GetBackupSHA256() string {
+	return viper.GetString(BACKUP_SHA256)
+}
+
+func (loadConfig) GetOCIUsername() string {
+	return viper.GetString(OCI_USERNAME)
+}
+
+func (loadConfig) GetOCIPassword() string {
+	return viper.GetString(OCI_PASSWORD)
+}
+
+func (loadConfig) GetOCIPlainHTTP() bool {
+	return viper.GetBool(OCI_PLAIN_HTTP)
+}
+
+func (loadConfig) GetLoadMode() LoadMode {
+	return LoadMode(viper.GetString(LOAD_MODE))
+}
+
+func (loadConfig) GetLoadExistingWorld() ExistingWorld {
+	return ExistingWorld(viper.GetString(LOAD_EXISTING_WORLD))
+}
+
+func (loadConfig) GetLoadInclude() []string {
+	return splitList(viper.GetString(LOAD_INCLUDE))
+}
+
+func (loadConfig) GetLoadExclude() []string {
+	return splitList(viper.GetString(LOAD_EXCLUDE))
+}
+
+func (loadConfig) GetLoadLayers() string {
+	return viper.GetString(LOAD_LAYERS)
+}
+
+func (loadConfig) GetLoadLayersFile() string {
+	return viper.GetString(LOAD_LAYERS_FILE)
+}
+
+// Returns the world name. Defaults to the default world name of the edition
+func (c loadConfig) GetLevelName() string {
+	if level := viper.GetString(LEVEL_NAME); level != "" {
+		return level
+	}
+
+	if c.GetEdition() == BedrockEdition {
+		return BEDROCK_LEVEL_NAME
+	}
+	return JAVA_LEVEL_NAME
+}
+
+// Returns the path of the world relative to the volume
+func (c loadConfig) GetWorldDir() string {
+	if c.GetEdition() == BedrockEdition {
+		return path.Join("worlds", c.GetLevelName())
+	}
+	return c.GetLevelName()
+}
+
+// Returns the paths of the world and its dimensions relative to the volume.
+// Java servers based on Bukkit keep the nether and the end next to the world
+func (c loadConfig) GetWorldDirs() []string {
+	if c.GetEdition() == BedrockEdition {
+		return []string{c.GetWorldDir()}
+	}
+	return []string{c.GetWorldDir(), c.GetWorldDir() + "_nether", c.GetWorldDir() + "_the_end"}
+}
+
+type backupsConfig struct {
+	serverConfig
+	storageConfig
+}
+
+func NewBackupsConfig() backupsConfig {
+	return backupsConfig{}
+}
+
 type fileServerConfig struct{}
 
 func NewFileServerConfig() fileServerConfig {
@@ -240,8 +972,20 @@ func (fileServerConfig) GetVolume() string {
 	return viper.GetString(VOLUME)
 }
 
+// Splits a comma separated list, dropping empty items. Items may contain spaces (e.g. "worlds/Bedrock level")
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func init() {
 	viper.SetDefault(INITIAL_DELAY, INITIAL_DELAY_DEFAULT)
+	viper.SetDefault(METRICS_ADDR, METRICS_ADDR_DEFAULT)
 	viper.SetDefault(HOST, HOST_DEFAULT)
 	viper.SetDefault(PORT, PORT_DEFAULT)
 	viper.SetDefault(EDITION, EDITION_DEFAULT)
@@ -252,9 +996,87 @@ func init() {
 	viper.SetDefault(INTERVAL, INTERVAL_DEFAULT)
 	viper.SetDefault(TIMEOUT, TIMEOUT_DEFAULT)
 	viper.SetDefault(MAX_ATTEMPTS, MAX_ATTEMPTS_DEFAULT)
+	viper.SetDefault(READY_CHECKS, READY_CHECKS_DEFAULT)
+	viper.SetDefault(HEALTH_CHECKS, HEALTH_CHECKS_DEFAULT)
+	viper.SetDefault(QUERY_PORT, QUERY_PORT_DEFAULT)
+	viper.SetDefault(RCON_CHECK_COMMAND, RCON_CHECK_COMMAND_DEFAULT)
+	viper.SetDefault(TPS_INTERVAL, TPS_INTERVAL_DEFAULT)
+	viper.SetDefault(TPS_COMMAND, TPS_COMMAND_DEFAULT)
+	viper.SetDefault(TPS_MIN, TPS_MIN_DEFAULT)
+	viper.SetDefault(MSPT_MAX, MSPT_MAX_DEFAULT)
+	viper.SetDefault(LAG_ACTION, LAG_ACTION_DEFAULT)
+	viper.SetDefault(PLAYER_TRACKING, PLAYER_TRACKING_DEFAULT)
+	viper.SetDefault(PLAYER_COUNTER, PLAYER_COUNTER_DEFAULT)
+	viper.SetDefault(PLAYER_LIST, PLAYER_LIST_DEFAULT)
+	viper.SetDefault(IDLE_TIMEOUT, IDLE_TIMEOUT_DEFAULT)
+	viper.SetDefault(IDLE_ONLY_ALLOCATED, IDLE_ONLY_ALLOCATED_DEFAULT)
+	viper.SetDefault(IDLE_WARNING, IDLE_WARNING_DEFAULT)
+	viper.SetDefault(IDLE_GRACE_PERIOD, IDLE_GRACE_PERIOD_DEFAULT)
+	viper.SetDefault(IDLE_BACKUP_URL, IDLE_BACKUP_URL_DEFAULT)
+	viper.SetDefault(METADATA_LABELS, METADATA_LABELS_DEFAULT)
+	viper.SetDefault(METADATA_ANNOTATIONS, METADATA_ANNOTATIONS_DEFAULT)
+	viper.SetDefault(AUTO_ALLOCATE, AUTO_ALLOCATE_DEFAULT)
+	viper.SetDefault(MAINTENANCE_CRON, MAINTENANCE_CRON_DEFAULT)
+	viper.SetDefault(MAINTENANCE_DURATION, MAINTENANCE_DURATION_DEFAULT)
 	viper.SetDefault(BUCKET_NAME, BUCKET_NAME_DEFAULT)
 	viper.SetDefault(BACKUP_CRON, BACKUP_CRON_DEFAULT)
 	viper.SetDefault(BACKUP_NAME, BACKUP_NAME_DEFAULT)
+	viper.SetDefault(SAVE_TIMEOUT, SAVE_TIMEOUT_DEFAULT)
+	viper.SetDefault(BACKUP_MODE, BACKUP_MODE_DEFAULT)
+	viper.SetDefault(BACKUP_SPOOL, BACKUP_SPOOL_DEFAULT)
+	viper.SetDefault(ARCHIVE_FORMAT, ARCHIVE_FORMAT_DEFAULT)
+	viper.SetDefault(COMPRESSION_LEVEL, COMPRESSION_LEVEL_DEFAULT)
+	viper.SetDefault(BACKUP_INCLUDE, BACKUP_INCLUDE_DEFAULT)
+	viper.SetDefault(BACKUP_EXCLUDE, BACKUP_EXCLUDE_DEFAULT)
+	viper.SetDefault(BACKUP_ON_SHUTDOWN, BACKUP_ON_SHUTDOWN_DEFAULT)
+	viper.SetDefault(BACKUP_ON_EMPTY, BACKUP_ON_EMPTY_DEFAULT)
+	viper.SetDefault(BACKUP_ACTIVE_INTERVAL, BACKUP_ACTIVE_INTERVAL_DEFAULT)
+	viper.SetDefault(BACKUP_POLL_INTERVAL, BACKUP_POLL_INTERVAL_DEFAULT)
+	viper.SetDefault(BACKUP_HTTP_ADDR, BACKUP_HTTP_ADDR_DEFAULT)
+	viper.SetDefault(BACKUP_PUBLISH_STATUS, BACKUP_PUBLISH_STATUS_DEFAULT)
+	viper.SetDefault(BACKUP_HOOKS, BACKUP_HOOKS_DEFAULT)
+	viper.SetDefault(BACKUP_HOOKS_FILE, BACKUP_HOOKS_FILE_DEFAULT)
+	viper.SetDefault(BACKUP_PREFIX, BACKUP_PREFIX_DEFAULT)
+	viper.SetDefault(BACKUP_BEFORE, BACKUP_BEFORE_DEFAULT)
+	viper.SetDefault(BACKUP_SHA256, BACKUP_SHA256_DEFAULT)
+	viper.SetDefault(OCI_USERNAME, OCI_USERNAME_DEFAULT)
+	viper.SetDefault(OCI_PASSWORD, OCI_PASSWORD_DEFAULT)
+	viper.SetDefault(OCI_PLAIN_HTTP, OCI_PLAIN_HTTP_DEFAULT)
+	viper.SetDefault(LOAD_MODE, LOAD_MODE_DEFAULT)
+	viper.SetDefault(LOAD_EXISTING_WORLD, LOAD_EXISTING_WORLD_DEFAULT)
+	viper.SetDefault(LOAD_INCLUDE, LOAD_INCLUDE_DEFAULT)
+	viper.SetDefault(LOAD_EXCLUDE, LOAD_EXCLUDE_DEFAULT)
+	viper.SetDefault(LEVEL_NAME, LEVEL_NAME_DEFAULT)
+	viper.SetDefault(LOAD_LAYERS, LOAD_LAYERS_DEFAULT)
+	viper.SetDefault(LOAD_LAYERS_FILE, LOAD_LAYERS_FILE_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_LAST, RETENTION_KEEP_LAST_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_DAILY, RETENTION_KEEP_DAILY_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_WEEKLY, RETENTION_KEEP_WEEKLY_DEFAULT)
+	viper.SetDefault(RETENTION_KEEP_MONTHLY, RETENTION_KEEP_MONTHLY_DEFAULT)
+	viper.SetDefault(RETENTION_MAX_AGE, RETENTION_MAX_AGE_DEFAULT)
+	viper.SetDefault(RETENTION_DRY_RUN, RETENTION_DRY_RUN_DEFAULT)
+	viper.SetDefault(STORAGE_BACKEND, STORAGE_BACKEND_DEFAULT)
+	viper.SetDefault(S3_ENDPOINT, S3_ENDPOINT_DEFAULT)
+	viper.SetDefault(S3_REGION, S3_REGION_DEFAULT)
+	viper.SetDefault(S3_ACCESS_KEY_ID, S3_ACCESS_KEY_ID_DEFAULT)
+	viper.SetDefault(S3_SECRET_ACCESS_KEY, S3_SECRET_ACCESS_KEY_DEFAULT)
+	viper.SetDefault(S3_INSECURE, S3_INSECURE_DEFAULT)
+	viper.SetDefault(S3_DISABLE_MULTIPART, S3_DISABLE_MULTIPART_DEFAULT)
+	viper.SetDefault(AZURE_STORAGE_CONNECTION_STRING, AZURE_STORAGE_CONNECTION_STRING_DEFAULT)
+	viper.SetDefault(AZURE_STORAGE_ACCOUNT, AZURE_STORAGE_ACCOUNT_DEFAULT)
+	viper.SetDefault(AZURE_STORAGE_KEY, AZURE_STORAGE_KEY_DEFAULT)
+	viper.SetDefault(AZURE_STORAGE_ENDPOINT, AZURE_STORAGE_ENDPOINT_DEFAULT)
+	viper.SetDefault(ENCRYPTION_PASSPHRASE, ENCRYPTION_PASSPHRASE_DEFAULT)
+	viper.SetDefault(ENCRYPTION_RECIPIENTS, ENCRYPTION_RECIPIENTS_DEFAULT)
+	viper.SetDefault(ENCRYPTION_RECIPIENTS_FILE, ENCRYPTION_RECIPIENTS_FILE_DEFAULT)
+	viper.SetDefault(ENCRYPTION_IDENTITY, ENCRYPTION_IDENTITY_DEFAULT)
+	viper.SetDefault(ENCRYPTION_IDENTITY_FILE, ENCRYPTION_IDENTITY_FILE_DEFAULT)
+	viper.SetDefault(TRANSFER_TIMEOUT, TRANSFER_TIMEOUT_DEFAULT)
+	viper.SetDefault(TRANSFER_RETRIES, TRANSFER_RETRIES_DEFAULT)
+	viper.SetDefault(TRANSFER_BACKOFF, TRANSFER_BACKOFF_DEFAULT)
+	viper.SetDefault(TRANSFER_CHUNK_SIZE_MIB, TRANSFER_CHUNK_SIZE_MIB_DEFAULT)
+	viper.SetDefault(TRANSFER_CONCURRENCY, TRANSFER_CONCURRENCY_DEFAULT)
+	viper.SetDefault(TRANSFER_BANDWIDTH_LIMIT, TRANSFER_BANDWIDTH_LIMIT_DEFAULT)
 
 	viper.AutomaticEnv()
 }
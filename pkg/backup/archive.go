@@ -0,0 +1,331 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Archive format
+type Format string
+
+const (
+	ZipFormat    Format = "zip"
+	TarGzFormat  Format = "tar.gz"
+	TarZstFormat Format = "tar.zst"
+)
+
+const (
+	TarGzContentType  string = "application/gzip"
+	TarZstContentType string = "application/zstd"
+)
+
+const (
+	// Compression levels. Other levels are passed to the compressor of the format
+	// (1-9 for zip and tar.gz, 1-22 for tar.zst). tar.zst has no uncompressed level and uses its fastest for NoCompression
+
+	DefaultCompression = -1
+	NoCompression      = 0
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Parses an archive format name
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case ZipFormat, TarGzFormat, TarZstFormat:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown archive format %q. must be zip, tar.gz or tar.zst", s)
+	}
+}
+
+// Returns the file extension of the format including the leading dot
+func (f Format) Ext() string {
+	return "." + string(f)
+}
+
+func (f Format) ContentType() string {
+	switch f {
+	case TarGzFormat:
+		return TarGzContentType
+	case TarZstFormat:
+		return TarZstContentType
+	default:
+		return ZipContentType
+	}
+}
+
+// Writes an archive of the given paths (relative to base) in the given format and compression level to w.
+// Returns the size and checksum of every archived file
+func Archive(base string, paths []string, w io.Writer, format Format, level int) ([]File, error) {
+	switch format {
+	case ZipFormat:
+		return Zipit(base, paths, w, level)
+	case TarGzFormat:
+		zw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, err
+		}
+
+		return tarTo(zw, base, paths)
+	case TarZstFormat:
+		// zstd can't store data uncompressed, so NoCompression uses the fastest level
+		zlevel := zstd.SpeedDefault
+		if level == NoCompression {
+			zlevel = zstd.SpeedFastest
+		} else if level > 0 {
+			zlevel = zstd.EncoderLevelFromZstd(level)
+		}
+
+		zw, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zlevel))
+		if err != nil {
+			return nil, err
+		}
+
+		return tarTo(zw, base, paths)
+	default:
+		return nil, fmt.Errorf("unknown archive format %q", format)
+	}
+}
+
+// Writes a tar of the given paths to the compressor and closes it
+func tarTo(zw io.WriteCloser, base string, paths []string) ([]File, error) {
+	tw := tar.NewWriter(zw)
+
+	var files []File
+	for _, rel := range paths {
+		file, err := addToTar(tw, base, rel)
+		if err != nil {
+			tw.Close()
+			zw.Close()
+			return nil, err
+		}
+
+		if file != nil {
+			files = append(files, *file)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		zw.Close()
+		return nil, err
+	}
+
+	return files, zw.Close()
+}
+
+func addToTar(tw *tar.Writer, base, rel string) (*File, error) {
+	path := filepath.Join(base, rel)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip sockets, pipes, devices, etc.
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return nil, err
+	}
+
+	header.Name = filepath.ToSlash(rel)
+
+	if info.IsDir() {
+		header.Name += "/"
+	}
+
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	return copyFile(tw, path, header.Name, header.Size)
+}
+
+// Copies size bytes of the file at path to w and returns its checksum entry under name
+func copyFile(w io.Writer, path, name string, size int64) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	digest := NewDigest()
+	if _, err := io.CopyN(io.MultiWriter(w, digest), file, size); err != nil {
+		return nil, err
+	}
+
+	return &File{Path: name, Size: digest.Size(), SHA256: digest.Sum()}, nil
+}
+
+// Detects the format of an archive from its content type, falling back to the magic bytes at the start of the archive
+func DetectFormat(contentType string, header []byte) (Format, error) {
+	switch contentType {
+	case ZipContentType, "application/x-zip-compressed":
+		return ZipFormat, nil
+	case TarGzContentType, "application/x-gzip", "application/x-tar+gzip":
+		return TarGzFormat, nil
+	case TarZstContentType, "application/x-zstd", "application/x-tar+zstd":
+		return TarZstFormat, nil
+	}
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic):
+		return ZipFormat, nil
+	case bytes.HasPrefix(header, gzipMagic):
+		return TarGzFormat, nil
+	case bytes.HasPrefix(header, zstdMagic):
+		return TarZstFormat, nil
+	}
+
+	return "", fmt.Errorf("unknown archive format (content type %q)", contentType)
+}
+
+// Called for every directory and regular file in an archive with the entry name and mode.
+// r reads the file contents and is empty for directories
+type WalkFunc func(name string, mode fs.FileMode, r io.Reader) error
+
+// Detects the format of the archive at src from contentType or the archive's magic bytes
+func DetectFileFormat(src, contentType string) (Format, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	header := make([]byte, 4)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	return DetectFormat(contentType, header[:n])
+}
+
+// Calls fn for every entry of the archive at src. The format is detected from contentType or the archive's magic bytes
+func Walk(src, contentType string, fn WalkFunc) error {
+	format, err := DetectFileFormat(src, contentType)
+	if err != nil {
+		return err
+	}
+
+	if format == ZipFormat {
+		return walkZip(src, fn)
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	switch format {
+	case TarGzFormat:
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+
+		defer zr.Close()
+
+		return walkTar(zr, fn)
+	default:
+		zr, err := zstd.NewReader(file)
+		if err != nil {
+			return err
+		}
+
+		defer zr.Close()
+
+		return walkTar(zr, fn)
+	}
+}
+
+// Extracts a tar stream into targetDir, restoring each entry to its relative path.
+// Only directories and regular files are extracted. Returns an error for entries that would be written outside of targetDir
+func Untar(r io.Reader, targetDir string) error {
+	return walkTar(r, extractTo(targetDir))
+}
+
+func walkTar(r io.Reader, fn WalkFunc) error {
+	tr := tar.NewReader(r)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+			if err := fn(header.Name, header.FileInfo().Mode(), tr); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Returns a WalkFunc that restores entries to their relative path in targetDir.
+// Returns an error for entries that would be written outside of targetDir
+func extractTo(targetDir string) WalkFunc {
+	return func(name string, mode fs.FileMode, r io.Reader) error {
+		target, err := SafeJoin(targetDir, name)
+		if err != nil {
+			return err
+		}
+
+		if mode.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+
+		return writeFile(target, r, mode.Perm())
+	}
+}
+
+// Writes r to a new file at target, creating parent directories
+func writeFile(target string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if perm == 0 {
+		perm = 0644
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,191 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Azure Blob Storage connection options. A connection string takes precedence over account name and key
+type Options struct {
+	ConnectionString string
+	Account          string
+	Key              string
+	Endpoint         string
+
+	// Timeouts, retries and block size
+	Transfer backup.TransferOptions
+}
+
+type AzureClient struct {
+	ctx           context.Context
+	client        *azblob.Client
+	containerName string
+	transfer      backup.TransferOptions
+}
+
+// Creates a new Azure Blob Storage client for the given container
+func New(ctx context.Context, containerName string, opts Options) (backup.BackupClient, error) {
+	transfer := opts.Transfer.WithDefaults()
+
+	// every request, including each uploaded block and downloaded range, is retried by the SDK
+	clientOpts := &azblob.ClientOptions{
+		ClientOptions: azcore.ClientOptions{
+			Retry: policy.RetryOptions{
+				MaxRetries:    int32(transfer.Retries),
+				TryTimeout:    transfer.Timeout,
+				RetryDelay:    transfer.Backoff,
+				MaxRetryDelay: backup.MaxBackoff,
+			},
+		},
+	}
+
+	// the SDK retries 3 times when MaxRetries is 0
+	if transfer.Retries == 0 {
+		clientOpts.Retry.MaxRetries = -1
+	}
+
+	if opts.ConnectionString != "" {
+		client, err := azblob.NewClientFromConnectionString(opts.ConnectionString, clientOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		return &AzureClient{ctx, client, containerName, transfer}, nil
+	}
+
+	if opts.Account == "" || opts.Key == "" {
+		return nil, fmt.Errorf("azure storage account and key or a connection string are required")
+	}
+
+	cred, err := azblob.NewSharedKeyCredential(opts.Account, opts.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.blob.core.windows.net/", opts.Account)
+	}
+
+	client, err := azblob.NewClientWithSharedKeyCredential(endpoint, cred, clientOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AzureClient{ctx, client, containerName, transfer}, nil
+}
+
+// Uploads r in blocks of the transfer chunk size. Blocks are staged in parallel and each block is retried on its own
+func (a *AzureClient) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	_, err := a.client.UploadStream(a.ctx, a.containerName, name, r, &azblob.UploadStreamOptions{
+		BlockSize:   a.transfer.ChunkSize,
+		Concurrency: a.transfer.Concurrency,
+		HTTPHeaders: &blob.HTTPHeaders{BlobContentType: &opts.ContentType},
+	})
+
+	return err
+}
+
+// Downloads the blob in parallel ranges
+func (a *AzureClient) Download(name string, w io.Writer) error {
+	obj, err := a.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	return backup.DownloadRanges(a.ctx, obj.Size, a.transfer, func(ctx context.Context, offset, length int64, w io.Writer) error {
+		res, err := a.client.DownloadStream(ctx, a.containerName, name, &azblob.DownloadStreamOptions{
+			Range: blob.HTTPRange{Offset: offset, Count: length},
+		})
+		if err != nil {
+			return err
+		}
+
+		defer res.Body.Close()
+
+		_, err = io.Copy(w, res.Body)
+		return err
+	}, w)
+}
+
+func (a *AzureClient) Stat(name string) (backup.Object, error) {
+	ctx, cancel := a.transfer.Context(a.ctx)
+	defer cancel()
+
+	props, err := a.client.ServiceClient().NewContainerClient(a.containerName).NewBlobClient(name).GetProperties(ctx, nil)
+	if bloberror.HasCode(err, bloberror.BlobNotFound) {
+		return backup.Object{}, backup.NotFound(err)
+	}
+	if err != nil {
+		return backup.Object{}, err
+	}
+
+	obj := backup.Object{Name: name}
+	if props.ContentLength != nil {
+		obj.Size = *props.ContentLength
+	}
+	if props.CreationTime != nil {
+		obj.Created = *props.CreationTime
+	}
+	if props.ContentType != nil {
+		obj.ContentType = *props.ContentType
+	}
+
+	return obj, nil
+}
+
+func (a *AzureClient) List(prefix string) ([]backup.Object, error) {
+	ctx, cancel := a.transfer.Context(a.ctx)
+	defer cancel()
+
+	pager := a.client.NewListBlobsFlatPager(a.containerName, &azblob.ListBlobsFlatOptions{Prefix: &prefix})
+
+	var objs []backup.Object
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range page.Segment.BlobItems {
+			obj := backup.Object{Name: *item.Name}
+
+			if props := item.Properties; props != nil {
+				if props.ContentLength != nil {
+					obj.Size = *props.ContentLength
+				}
+				if props.CreationTime != nil {
+					obj.Created = *props.CreationTime
+				}
+				if props.ContentType != nil {
+					obj.ContentType = *props.ContentType
+				}
+			}
+
+			objs = append(objs, obj)
+		}
+	}
+
+	return objs, nil
+}
+
+func (a *AzureClient) Delete(name string) error {
+	ctx, cancel := a.transfer.Context(a.ctx)
+	defer cancel()
+
+	_, err := a.client.DeleteBlob(ctx, a.containerName, name, nil)
+	return err
+}
+
+func (a *AzureClient) Close() error {
+	return nil
+}
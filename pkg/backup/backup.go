@@ -2,80 +2,226 @@ package backup
 
 import (
 	"archive/zip"
+	"compress/flate"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strings"
+	"time"
 )
 
 const ZipContentType string = "application/zip"
 
+// Returned by clients that can't perform an operation, e.g. read-only sources that worlds are only loaded from
+var ErrNotSupported = errors.New("operation not supported by backup storage")
+
+// Returned by Stat and Download when the object doesn't exist. Other errors, e.g. timeouts or denied access,
+// don't mean the object is missing
+var ErrNotFound = errors.New("backup object not found")
+
+// Wraps a backend's not found error in ErrNotFound
+func NotFound(err error) error {
+	return fmt.Errorf("%w: %w", ErrNotFound, err)
+}
+
 type BackupClient interface {
-	Load(name, targetVol string) error
-	Backup(file *os.File) error
+	Backup(name string, r io.Reader, opts UploadOptions) error
+	Download(name string, w io.Writer) error
+	Stat(name string) (Object, error)
+	List(prefix string) ([]Object, error)
+	Delete(name string) error
 	Close() error
 }
 
-func Zipit(source, target string) error {
-	zipfile, err := os.Create(target)
-	if err != nil {
-		return err
-	}
+// Options for uploading a backup object
+type UploadOptions struct {
+	ContentType string
+	// Object size in bytes. 0 if unknown, e.g. when streaming
+	Size int64
+}
 
-	defer zipfile.Close()
+// Backup object stored in a bucket
+type Object struct {
+	Name        string
+	Size        int64
+	Created     time.Time
+	ContentType string
+}
 
-	archive := zip.NewWriter(zipfile)
-	defer archive.Close()
+// Matches backup names generated by Name. <server>-<RFC3339 timestamp>.<ext>
+var nameRegexp = regexp.MustCompile(`^(.*)-(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2}))(?:\..+)?$`)
 
-	info, err := os.Stat(source)
+// Returns the backup name for a server at the given time. ext includes the leading dot (e.g. ".zip")
+func Name(server string, t time.Time, ext string) string {
+	return fmt.Sprintf("%s-%v%s", server, t.Format(time.RFC3339), ext)
+}
+
+// Parses the server name and timestamp out of a backup name generated by Name
+func ParseName(name string) (server string, t time.Time, ok bool) {
+	m := nameRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return "", time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, m[2])
 	if err != nil {
-		return nil
+		return "", time.Time{}, false
 	}
 
-	var baseDir string
-	if info.IsDir() {
-		baseDir = filepath.Base(source)
+	return m[1], t, true
+}
+
+// Returns the time the backup was taken. Uses the timestamp in the backup name and falls back to the object creation time
+func (o Object) Timestamp() time.Time {
+	if _, t, ok := ParseName(o.Name); ok {
+		return t
 	}
+	return o.Created
+}
 
-	err = filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// Returns the newest backup taken at or before before, by the timestamp in its name. Objects that are not
+// backups, such as manifests and incremental blobs, are skipped. A zero before selects the newest backup
+func Latest(objs []Object, before time.Time) (Object, bool) {
+	var latest Object
+	var latestTime time.Time
+	found := false
 
-		header, err := zip.FileInfoHeader(info)
-		if err != nil {
-			return err
+	for _, obj := range objs {
+		if IsManifest(obj.Name) {
+			continue
 		}
 
-		if baseDir != "" {
-			header.Name = filepath.Join(baseDir, strings.TrimPrefix(path, source))
+		_, t, ok := ParseName(path.Base(obj.Name))
+		if !ok || (!before.IsZero() && t.After(before)) {
+			continue
 		}
 
-		if info.IsDir() {
-			header.Name += "/"
-		} else {
-			header.Method = zip.Deflate
+		if !found || t.After(latestTime) {
+			latest, latestTime, found = obj, t, true
 		}
+	}
+
+	return latest, found
+}
+
+// Writes a zip archive of the given paths to w. Paths are relative to base and keep their relative path
+// as the entry name so they can be restored to the same location. Directories are added as entries but not walked.
+// Files are compressed with Deflate at the given level (DefaultCompression, or NoCompression to store them as is).
+// Returns the size and checksum of every archived file
+func Zipit(base string, paths []string, w io.Writer, level int) ([]File, error) {
+	archive := zip.NewWriter(w)
+	archive.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+
+	method := zip.Deflate
+	if level == NoCompression {
+		method = zip.Store
+	}
 
-		writer, err := archive.CreateHeader(header)
+	var files []File
+	for _, rel := range paths {
+		file, err := addToZip(archive, base, rel, method)
 		if err != nil {
-			return err
+			archive.Close()
+			return nil, err
 		}
 
-		if info.IsDir() {
-			return nil
+		if file != nil {
+			files = append(files, *file)
 		}
+	}
 
-		file, err := os.Open(path)
-		if err != nil {
+	return files, archive.Close()
+}
+
+func addToZip(archive *zip.Writer, base, rel string, method uint16) (*File, error) {
+	path := filepath.Join(base, rel)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip sockets, pipes, devices, etc.
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil, nil
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+
+	header.Name = filepath.ToSlash(rel)
+
+	if info.IsDir() {
+		header.Name += "/"
+	} else {
+		header.Method = method
+	}
+
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, nil
+	}
+
+	return copyFile(writer, path, header.Name, info.Size())
+}
+
+// Extracts the zip archive at src into targetDir, restoring each entry to its relative path.
+// Returns an error for entries that would be written outside of targetDir
+func Unzip(src, targetDir string) error {
+	return walkZip(src, extractTo(targetDir))
+}
+
+func walkZip(src string, fn WalkFunc) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+
+	defer r.Close()
+
+	for _, f := range r.File {
+		if err := walkZipFile(f, fn); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
 
-		defer file.Close()
+func walkZipFile(f *zip.File, fn WalkFunc) error {
+	if f.FileInfo().IsDir() {
+		return fn(f.Name, f.Mode(), strings.NewReader(""))
+	}
 
-		_, err = io.Copy(writer, file)
+	rc, err := f.Open()
+	if err != nil {
 		return err
-	})
+	}
+
+	defer rc.Close()
+
+	return fn(f.Name, f.Mode(), rc)
+}
+
+// Joins an archive entry name to base. Returns an error if the name is absolute or escapes base
+func SafeJoin(base, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal path in archive: %q", name)
+	}
 
-	return err
+	return filepath.Join(base, clean), nil
 }
@@ -0,0 +1,248 @@
+package crypt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Encrypted objects are stored in the age format (https://age-encryption.org/v1): a header with the file key wrapped
+// for every recipient, a 16 byte nonce and the payload split into 64 KiB chunks that are each followed by a 16 byte tag
+const (
+	payloadChunkSize = 64 << 10
+	payloadTagSize   = 16
+)
+
+// First line of every age file
+var ageMagic = []byte("age-encryption.org/v1\n")
+
+// Returned when downloading an encrypted object without a passphrase or identity to decrypt it with
+var ErrNoIdentity = errors.New("backup is encrypted but no passphrase or identity is configured to decrypt it")
+
+type Options struct {
+	// Passphrase to encrypt and decrypt with. Can't be combined with recipients
+	Passphrase string
+
+	// age public keys (age1...) to encrypt to
+	Recipients     []string
+	RecipientsFile string
+
+	// age secret keys (AGE-SECRET-KEY-1...) to decrypt with
+	Identities   []string
+	IdentityFile string
+}
+
+// Backup client that encrypts objects before they are uploaded and decrypts them as they are downloaded.
+// Objects that are not encrypted are downloaded as is
+type Client struct {
+	client     backup.BackupClient
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// Wraps client with age encryption. Uploads are encrypted when a passphrase or recipients are set,
+// downloads are decrypted when a passphrase or identities are set
+func New(client backup.BackupClient, opts Options) (*Client, error) {
+	c := &Client{client: client}
+
+	recipients, err := parseKeys(opts.Recipients, opts.RecipientsFile, age.ParseRecipients)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipients: %w", err)
+	}
+
+	identities, err := parseKeys(opts.Identities, opts.IdentityFile, age.ParseIdentities)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identities: %w", err)
+	}
+
+	if opts.Passphrase != "" {
+		if len(recipients) > 0 {
+			return nil, errors.New("a passphrase can't be combined with recipients")
+		}
+
+		recipient, err := age.NewScryptRecipient(opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		identity, err := age.NewScryptIdentity(opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, recipient)
+		identities = append(identities, identity)
+	}
+
+	c.recipients = recipients
+	c.identities = identities
+
+	return c, nil
+}
+
+// Parses the keys given inline and in file with parse. Returns nil if neither are set
+func parseKeys[T any](keys []string, file string, parse func(io.Reader) ([]T, error)) ([]T, error) {
+	var parsed []T
+
+	if len(keys) > 0 {
+		p, err := parse(strings.NewReader(strings.Join(keys, "\n")))
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p...)
+	}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+
+		defer f.Close()
+
+		p, err := parse(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		parsed = append(parsed, p...)
+	}
+
+	return parsed, nil
+}
+
+// Checks if uploads are encrypted
+func (c *Client) Encrypted() bool {
+	return len(c.recipients) > 0
+}
+
+// Encrypts r and uploads it as name. The content type is kept so the archive format can still be detected after decryption
+func (c *Client) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	if !c.Encrypted() {
+		return c.client.Backup(name, r, opts)
+	}
+
+	// age writes the header and nonce as soon as it is created. they are buffered so the upload can start with them
+	var header bytes.Buffer
+	dst := &switchWriter{w: &header}
+
+	ew, err := age.Encrypt(dst, c.recipients...)
+	if err != nil {
+		return err
+	}
+
+	pr, pw := io.Pipe()
+	dst.w = pw
+
+	if opts.Size > 0 {
+		opts.Size = int64(header.Len()) + payloadSize(opts.Size)
+	}
+
+	go func() {
+		_, err := io.Copy(ew, r)
+		if err == nil {
+			err = ew.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	err = c.client.Backup(name, io.MultiReader(&header, pr), opts)
+
+	// unblocks the encrypting goroutine if the upload stopped reading early
+	pr.CloseWithError(err)
+
+	return err
+}
+
+// Returns the size of the encrypted payload for a plaintext of size bytes, excluding the nonce
+func payloadSize(size int64) int64 {
+	chunks := (size + payloadChunkSize - 1) / payloadChunkSize
+	if chunks == 0 {
+		chunks = 1
+	}
+	return size + chunks*payloadTagSize
+}
+
+// Downloads name into w, decrypting it if it is encrypted
+func (c *Client) Download(name string, w io.Writer) error {
+	pr, pw := io.Pipe()
+
+	errc := make(chan error, 1)
+	go func() {
+		err := c.client.Download(name, pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	err := c.decrypt(pr, w)
+
+	// unblocks the download if decryption stopped reading early
+	pr.CloseWithError(err)
+
+	downloadErr := <-errc
+
+	if err != nil {
+		return fmt.Errorf("decrypting %s: %w", name, err)
+	}
+
+	return downloadErr
+}
+
+func (c *Client) decrypt(r io.Reader, w io.Writer) error {
+	br := bufio.NewReader(r)
+
+	// objects shorter than the magic can't be encrypted
+	if header, _ := br.Peek(len(ageMagic)); !bytes.Equal(header, ageMagic) {
+		_, err := io.Copy(w, br)
+		return err
+	}
+
+	if len(c.identities) == 0 {
+		return ErrNoIdentity
+	}
+
+	dr, err := age.Decrypt(br, c.identities...)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, dr)
+	return err
+}
+
+func (c *Client) Stat(name string) (backup.Object, error) {
+	return c.client.Stat(name)
+}
+
+func (c *Client) List(prefix string) ([]backup.Object, error) {
+	return c.client.List(prefix)
+}
+
+func (c *Client) Delete(name string) error {
+	return c.client.Delete(name)
+}
+
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+// Forwards the content length requirement of the wrapped client
+func (c *Client) RequiresContentLength() bool {
+	return backup.RequiresContentLength(c.client)
+}
+
+// Writer whose destination can be swapped after it is handed out
+type switchWriter struct {
+	w io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
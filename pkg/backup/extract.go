@@ -0,0 +1,134 @@
+package backup
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// File that marks the root directory of a Minecraft world
+const levelFile = "level.dat"
+
+// Options for extracting a backup into a server volume
+type ExtractOptions struct {
+	// Volume path of the world, e.g. "world" or "worlds/Bedrock level". Archives that only contain a world,
+	// such as a downloaded map or a backup made before server files were included, are extracted into it.
+	// Entry names are kept as is when empty
+	WorldDir string
+
+	// Globs of volume paths to extract. Everything is extracted when Include is empty
+	Include []string
+	Exclude []string
+
+	// Skip files that already exist in the target directory instead of overwriting them
+	KeepExisting bool
+}
+
+// Extracts the archive at src into targetDir. The format is detected from contentType or the archive's magic bytes.
+// Backups in the volume layout restore every file to its relative path, archives of a single world are extracted into opts.WorldDir
+func Extract(src, targetDir, contentType string, opts ExtractOptions) error {
+	rename := func(name string) (string, bool) {
+		return name, true
+	}
+
+	if opts.WorldDir != "" {
+		root, err := findWorldRoot(src, contentType, opts.WorldDir)
+		if err != nil {
+			return err
+		}
+
+		if root != "" {
+			rename = rebase(root, opts.WorldDir)
+		}
+	}
+
+	extract := extractTo(targetDir)
+
+	return Walk(src, contentType, func(name string, mode fs.FileMode, r io.Reader) error {
+		name, ok := rename(path.Clean(name))
+		if !ok || !Selected(name, opts.Include, opts.Exclude) {
+			return nil
+		}
+
+		if opts.KeepExisting && !mode.IsDir() {
+			if target, err := SafeJoin(targetDir, name); err == nil && exists(target) {
+				return nil
+			}
+		}
+
+		return extract(name, mode, r)
+	})
+}
+
+// Returns the archive directory of the world to extract into worldDir, or "" if the archive is in the volume layout.
+// An archive is in the volume layout when it has a world at worldDir or server.properties at its root
+func findWorldRoot(src, contentType, worldDir string) (string, error) {
+	var levelDirs []string
+	volumeLayout := false
+
+	err := Walk(src, contentType, func(name string, mode fs.FileMode, r io.Reader) error {
+		name = path.Clean(name)
+
+		switch {
+		case name == "server.properties" || name == path.Join(worldDir, levelFile):
+			volumeLayout = true
+		case path.Base(name) == levelFile && !mode.IsDir():
+			levelDirs = append(levelDirs, path.Dir(name))
+		}
+
+		return nil
+	})
+
+	if err != nil || volumeLayout || len(levelDirs) == 0 {
+		return "", err
+	}
+
+	// the shallowest world is the main one. e.g. world rather than world/DIM1
+	sort.Slice(levelDirs, func(i, j int) bool {
+		if di, dj := depth(levelDirs[i]), depth(levelDirs[j]); di != dj {
+			return di < dj
+		}
+		return levelDirs[i] < levelDirs[j]
+	})
+
+	return levelDirs[0], nil
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func depth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// Returns a rename func that moves the entries under root to worldDir and skips all other entries
+func rebase(root, worldDir string) func(name string) (string, bool) {
+	return func(name string) (string, bool) {
+		// keep entries that escape the archive so they are rejected when extracting
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return name, true
+		}
+
+		if root == "." {
+			return path.Join(worldDir, name), true
+		}
+
+		if name == root {
+			return worldDir, true
+		}
+
+		if rel, ok := strings.CutPrefix(name, root+"/"); ok {
+			return path.Join(worldDir, rel), true
+		}
+
+		return "", false
+	}
+}
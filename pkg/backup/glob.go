@@ -0,0 +1,105 @@
+package backup
+
+import (
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Reports whether a slash-separated path matches a glob pattern.
+// Supports path.Match syntax within a path segment and ** to match zero or more segments
+func Match(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		if matchSegments(pattern[1:], name) {
+			return true
+		}
+		return len(name) > 0 && matchSegments(pattern, name[1:])
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	ok, err := path.Match(pattern[0], name[0])
+	if err != nil || !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], name[1:])
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Walks base and returns the slash-separated relative paths of the files and directories to back up.
+// A path is selected when it or one of its parent directories matches an include pattern and
+// neither it nor a parent directory matches an exclude pattern
+func Select(base string, include, exclude []string) ([]string, error) {
+	var paths []string
+
+	err := filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+
+		if rel == "." {
+			return nil
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		if matchAny(exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if included(include, rel) {
+			paths = append(paths, rel)
+		}
+
+		return nil
+	})
+
+	return paths, err
+}
+
+// Checks if a slash-separated relative path is selected by the include and exclude patterns, the same way Select does.
+// Every path is included when include is empty
+func Selected(rel string, include, exclude []string) bool {
+	if included(exclude, rel) {
+		return false
+	}
+	return len(include) == 0 || included(include, rel)
+}
+
+// Checks if the path or any of its parent directories match a pattern
+func included(patterns []string, rel string) bool {
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if matchAny(patterns, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,39 +2,62 @@ package google
 
 import (
 	"context"
+	"errors"
 	"io"
-	"os"
-	"path"
+	"time"
 
 	"cloud.google.com/go/storage"
+	"github.com/googleapis/gax-go/v2"
+	"google.golang.org/api/iterator"
 
 	"github.com/raefon/agones-mc/pkg/backup"
 )
 
 type GoogleClient struct {
-	client  *storage.Client
-	bktName string
+	ctx      context.Context
+	client   *storage.Client
+	bktName  string
+	transfer backup.TransferOptions
 }
 
-func New(ctx context.Context, bucketName string) (backup.BackupClient, error) {
+func New(ctx context.Context, bucketName string, transfer backup.TransferOptions) (backup.BackupClient, error) {
 	client, err := storage.NewClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &GoogleClient{client, bucketName}, nil
+	transfer = transfer.WithDefaults()
+
+	client.SetRetry(
+		storage.WithBackoff(gax.Backoff{Initial: transfer.Backoff, Max: backup.MaxBackoff, Multiplier: 2}),
+		storage.WithMaxAttempts(transfer.Retries+1),
+	)
+
+	return &GoogleClient{ctx, client, bucketName, transfer}, nil
 }
 
-func (g *GoogleClient) Backup(file *os.File) error {
-	ctx := context.Background()
+// Uploads r as a resumable upload in chunks of the transfer chunk size. A failed chunk is retried on its own
+func (g *GoogleClient) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	ctx, cancel := context.WithCancel(g.ctx)
+	defer cancel()
+
 	bkt := g.client.Bucket(g.bktName)
 
-	obj := bkt.Object(file.Name())
+	// resumable uploads can always be retried, even without preconditions
+	obj := bkt.Object(name).Retryer(storage.WithPolicy(storage.RetryAlways))
 
 	w := obj.NewWriter(ctx)
-	w.ContentType = backup.ZipContentType
+	w.ContentType = opts.ContentType
+	w.ChunkSize = int(g.transfer.ChunkSize)
+	w.ChunkTransferTimeout = g.transfer.Timeout
+	if g.transfer.Timeout > 0 {
+		w.ChunkRetryDeadline = g.transfer.Timeout * time.Duration(g.transfer.Retries+1)
+	}
 
-	if _, err := io.Copy(w, file); err != nil {
+	// cancelling the context aborts the upload so a partial object is never written
+	if _, err := io.Copy(w, r); err != nil {
+		cancel()
+		w.Close()
 		return err
 	}
 
@@ -45,33 +68,76 @@ func (g *GoogleClient) Backup(file *os.File) error {
 	return nil
 }
 
-func (g *GoogleClient) Load(name, targetVol string) error {
-	ctx := context.Background()
-	bkt := g.client.Bucket(g.bktName)
-
-	obj := bkt.Object(name)
+// Downloads the object in parallel ranges
+func (g *GoogleClient) Download(name string, w io.Writer) error {
+	obj := g.client.Bucket(g.bktName).Object(name)
 
-	r, err := obj.NewReader(ctx)
+	attrs, err := g.Stat(name)
 	if err != nil {
 		return err
 	}
 
-	zipfile, err := os.Create(path.Join(targetVol, "world.zip"))
-	if err != nil {
-		return err
-	}
+	return backup.DownloadRanges(g.ctx, attrs.Size, g.transfer, func(ctx context.Context, offset, length int64, w io.Writer) error {
+		r, err := obj.NewRangeReader(ctx, offset, length)
+		if err != nil {
+			return err
+		}
 
-	defer zipfile.Close()
+		defer r.Close()
 
-	if _, err := io.Copy(zipfile, r); err != nil {
+		_, err = io.Copy(w, r)
 		return err
+	}, w)
+}
+
+func (g *GoogleClient) Stat(name string) (backup.Object, error) {
+	ctx, cancel := g.transfer.Context(g.ctx)
+	defer cancel()
+
+	bkt := g.client.Bucket(g.bktName)
+
+	attrs, err := bkt.Object(name).Attrs(ctx)
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return backup.Object{}, backup.NotFound(err)
+	}
+	if err != nil {
+		return backup.Object{}, err
 	}
 
-	if err := r.Close(); err != nil {
-		return err
+	return backup.Object{Name: attrs.Name, Size: attrs.Size, Created: attrs.Created, ContentType: attrs.ContentType}, nil
+}
+
+func (g *GoogleClient) List(prefix string) ([]backup.Object, error) {
+	ctx, cancel := g.transfer.Context(g.ctx)
+	defer cancel()
+
+	bkt := g.client.Bucket(g.bktName)
+
+	it := bkt.Objects(ctx, &storage.Query{Prefix: prefix})
+
+	var objs []backup.Object
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		objs = append(objs, backup.Object{Name: attrs.Name, Size: attrs.Size, Created: attrs.Created, ContentType: attrs.ContentType})
 	}
 
-	return nil
+	return objs, nil
+}
+
+func (g *GoogleClient) Delete(name string) error {
+	ctx, cancel := g.transfer.Context(g.ctx)
+	defer cancel()
+
+	bkt := g.client.Bucket(g.bktName)
+
+	return bkt.Object(name).Delete(ctx)
 }
 
 func (g *GoogleClient) Close() error {
@@ -0,0 +1,467 @@
+package incremental
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Incremental backups split files into chunks that are stored once as content-addressed blobs.
+// Each snapshot is a manifest listing the files and the chunks they are made of, so unchanged
+// chunks are shared between snapshots and only new chunks are uploaded.
+//
+// Bucket layout:
+//
+//	blobs/<hash[:2]>/<hash>          gzip compressed chunk. hash is the SHA-256 of the uncompressed chunk
+//	snapshots/<server>-<time>.json   snapshot manifest
+//	leases/<server>.<unix nanos>     marks a snapshot that is being uploaded
+const (
+	BlobPrefix     = "blobs/"
+	SnapshotPrefix = "snapshots/"
+	LeasePrefix    = "leases/"
+
+	BlobContentType     = "application/gzip"
+	ManifestContentType = "application/json"
+
+	// Default chunk size. Minecraft region files are rewritten in place so fixed size chunks deduplicate well
+	DefaultChunkSize = 4 << 20
+
+	manifestVersion = 1
+)
+
+// Snapshot manifest
+type Manifest struct {
+	Version       int       `json:"version"`
+	Server        string    `json:"server"`
+	Edition       string    `json:"edition,omitempty"`
+	ServerVersion string    `json:"serverVersion,omitempty"`
+	Created       time.Time `json:"created"`
+	ChunkSize     int       `json:"chunkSize"`
+	Entries       []Entry   `json:"entries"`
+}
+
+// File or directory in a snapshot. Path is relative to the volume
+type Entry struct {
+	Path    string      `json:"path"`
+	Dir     bool        `json:"dir,omitempty"`
+	Mode    fs.FileMode `json:"mode"`
+	Size    int64       `json:"size"`
+	ModTime time.Time   `json:"modTime"`
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+// Returns the snapshot manifest name for a server at the given time
+func SnapshotName(server string, t time.Time) string {
+	return SnapshotPrefix + backup.Name(server, t, ".json")
+}
+
+// Checks if a backup name refers to an incremental snapshot manifest
+func IsSnapshot(name string) bool {
+	return strings.HasPrefix(name, SnapshotPrefix) && strings.HasSuffix(name, ".json")
+}
+
+// Returns the object name of the blob with the given hash
+func BlobName(hash string) string {
+	return BlobPrefix + hash[:2] + "/" + hash
+}
+
+// Returns the set of blob hashes already in storage
+func ListBlobs(client backup.BackupClient) (map[string]bool, error) {
+	objs, err := client.List(BlobPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	blobs := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		blobs[path.Base(obj.Name)] = true
+	}
+
+	return blobs, nil
+}
+
+// Stores the chunk with the given hash as a blob, e.g. UploadBlobs or StageBlobs
+type BlobWriter func(hash string, chunk []byte) error
+
+// Chunks the given paths (relative to base) and passes the chunks missing from known to put. Returns the snapshot manifest.
+// Only reads the volume so it can run while automatic saving is paused
+func Snapshot(base string, paths []string, known map[string]bool, put BlobWriter, chunkSize int) (*Manifest, error) {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	m := &Manifest{Version: manifestVersion, ChunkSize: chunkSize}
+	added := make(map[string]bool)
+	buf := make([]byte, chunkSize)
+
+	for _, rel := range paths {
+		info, err := os.Stat(filepath.Join(base, rel))
+		if err != nil {
+			return nil, err
+		}
+
+		entry := Entry{Path: rel, Mode: info.Mode().Perm(), ModTime: info.ModTime()}
+
+		if info.IsDir() {
+			entry.Dir = true
+			m.Entries = append(m.Entries, entry)
+			continue
+		}
+
+		// skip sockets, pipes, devices, etc.
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		chunks, size, err := chunkFile(filepath.Join(base, rel), buf, func(hash string, chunk []byte) error {
+			if known[hash] || added[hash] {
+				return nil
+			}
+
+			added[hash] = true
+			return put(hash, chunk)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		entry.Size = size
+		entry.Chunks = chunks
+		m.Entries = append(m.Entries, entry)
+	}
+
+	return m, nil
+}
+
+// Reads a file in chunks of len(buf) and calls f with the SHA-256 of every chunk. Returns the chunk hashes and file size
+func chunkFile(name string, buf []byte, f func(hash string, chunk []byte) error) ([]string, int64, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer file.Close()
+
+	var chunks []string
+	var size int64
+
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			sum := sha256.Sum256(buf[:n])
+			hash := hex.EncodeToString(sum[:])
+
+			if err := f(hash, buf[:n]); err != nil {
+				return nil, 0, err
+			}
+
+			chunks = append(chunks, hash)
+			size += int64(n)
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return chunks, size, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+}
+
+// Compresses a chunk into a blob
+func compress(w io.Writer, chunk []byte) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(chunk); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// Uploads every blob as it is chunked. Blobs are compressed in memory, so nothing is written to disk
+func UploadBlobs(client backup.BackupClient) BlobWriter {
+	return func(hash string, chunk []byte) error {
+		var buf bytes.Buffer
+		if err := compress(&buf, chunk); err != nil {
+			return err
+		}
+
+		return client.Backup(BlobName(hash), &buf, backup.UploadOptions{ContentType: BlobContentType, Size: int64(buf.Len())})
+	}
+}
+
+// Writes every blob to stageDir to be uploaded later with UploadStaged
+func StageBlobs(stageDir string) BlobWriter {
+	return func(hash string, chunk []byte) error {
+		file, err := os.Create(filepath.Join(stageDir, hash))
+		if err != nil {
+			return err
+		}
+
+		if err := compress(file, chunk); err != nil {
+			file.Close()
+			return err
+		}
+
+		return file.Close()
+	}
+}
+
+// Uploads the blobs staged by StageBlobs
+func UploadStaged(client backup.BackupClient, stageDir string) error {
+	staged, err := os.ReadDir(stageDir)
+	if err != nil {
+		return err
+	}
+
+	for _, blob := range staged {
+		if err := uploadStagedBlob(client, stageDir, blob.Name()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func uploadStagedBlob(client backup.BackupClient, stageDir, hash string) error {
+	file, err := os.Open(filepath.Join(stageDir, hash))
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	return client.Backup(BlobName(hash), file, backup.UploadOptions{ContentType: BlobContentType, Size: info.Size()})
+}
+
+// Uploads the snapshot manifest under name. Must be called after all of the snapshot's blobs are uploaded,
+// so a snapshot is never visible before its blobs
+func UploadManifest(client backup.BackupClient, m *Manifest, name string) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return client.Backup(name, bytes.NewReader(data), backup.UploadOptions{ContentType: ManifestContentType, Size: int64(len(data))})
+}
+
+// Downloads and decodes a snapshot manifest
+func ReadManifest(client backup.BackupClient, name string) (*Manifest, error) {
+	var buf bytes.Buffer
+	if err := client.Download(name, &buf); err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("invalid snapshot manifest %s: %w", name, err)
+	}
+
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported snapshot manifest version %d", m.Version)
+	}
+
+	return &m, nil
+}
+
+// Reassembles the snapshot with the given manifest name into targetDir. Only paths selected by include and exclude
+// are restored (see backup.Selected). Every chunk is checked against its hash while it is written
+func Restore(client backup.BackupClient, name, targetDir string, include, exclude []string) error {
+	m, err := ReadManifest(client, name)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range m.Entries {
+		if !backup.Selected(entry.Path, include, exclude) {
+			continue
+		}
+
+		target, err := backup.SafeJoin(targetDir, entry.Path)
+		if err != nil {
+			return err
+		}
+
+		if entry.Dir {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := restoreFile(client, entry, target); err != nil {
+			return fmt.Errorf("restoring %s: %w", entry.Path, err)
+		}
+	}
+
+	return nil
+}
+
+func restoreFile(client backup.BackupClient, entry Entry, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	perm := entry.Mode
+	if perm == 0 {
+		perm = 0644
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range entry.Chunks {
+		if err := restoreChunk(client, hash, file); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Chtimes(target, entry.ModTime, entry.ModTime)
+}
+
+// Checks that every chunk of the snapshot with the given manifest name is stored and matches its hash
+func Verify(client backup.BackupClient, name string) error {
+	m, err := ReadManifest(client, name)
+	if err != nil {
+		return err
+	}
+
+	verified := make(map[string]bool)
+	for _, entry := range m.Entries {
+		for _, hash := range entry.Chunks {
+			if verified[hash] {
+				continue
+			}
+
+			if err := restoreChunk(client, hash, io.Discard); err != nil {
+				return fmt.Errorf("verifying %s: %w", entry.Path, err)
+			}
+
+			verified[hash] = true
+		}
+	}
+
+	return nil
+}
+
+func restoreChunk(client backup.BackupClient, hash string, w io.Writer) error {
+	var buf bytes.Buffer
+	if err := client.Download(BlobName(hash), &buf); err != nil {
+		return err
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w, h), zr); err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != hash {
+		return fmt.Errorf("blob %s is corrupt. content hash is %s", hash, sum)
+	}
+
+	return nil
+}
+
+// Marks a snapshot of server that started at start as in progress until release is called. Snapshots reuse stored blobs
+// that may not be referenced by any other snapshot, so Unreferenced doesn't return any blobs while a snapshot is in progress.
+// The lease name doesn't parse as a backup name, so it is never loaded as the latest backup
+func Lease(client backup.BackupClient, server string, start time.Time) (release func() error, err error) {
+	name := LeasePrefix + server + "." + strconv.FormatInt(start.UnixNano(), 10)
+	data := []byte(start.UTC().Format(time.RFC3339))
+
+	if err := client.Backup(name, bytes.NewReader(data), backup.UploadOptions{ContentType: "text/plain", Size: int64(len(data))}); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		return client.Delete(name)
+	}, nil
+}
+
+// Returns the blobs that are not referenced by any snapshot and were uploaded before now - grace. Returns an error while
+// a snapshot that started within the grace period is in progress, since it may reuse unreferenced blobs of any age.
+// Leases older than the grace period are left by backups that didn't finish and are returned for deletion
+func Unreferenced(client backup.BackupClient, grace time.Duration, now time.Time) ([]backup.Object, error) {
+	snapshots, err := client.List(SnapshotPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool)
+	for _, snapshot := range snapshots {
+		if !IsSnapshot(snapshot.Name) {
+			continue
+		}
+
+		m, err := ReadManifest(client, snapshot.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range m.Entries {
+			for _, hash := range entry.Chunks {
+				referenced[hash] = true
+			}
+		}
+	}
+
+	blobs, err := client.List(BlobPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var unreferenced []backup.Object
+	for _, blob := range blobs {
+		if referenced[path.Base(blob.Name)] || blob.Created.After(now.Add(-grace)) {
+			continue
+		}
+
+		unreferenced = append(unreferenced, blob)
+	}
+
+	// checked after listing the blobs, so a snapshot that started before they were listed is always seen
+	leases, err := client.List(LeasePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lease := range leases {
+		if lease.Created.After(now.Add(-grace)) {
+			return nil, fmt.Errorf("snapshot in progress since %s (%s). try again once it is uploaded", lease.Created.UTC().Format(time.RFC3339), lease.Name)
+		}
+
+		unreferenced = append(unreferenced, lease)
+	}
+
+	return unreferenced, nil
+}
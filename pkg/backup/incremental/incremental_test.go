@@ -0,0 +1,232 @@
+package incremental
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+	"github.com/raefon/agones-mc/pkg/backup/local"
+)
+
+// Client that requires the size of every upload, like S3 without multipart uploads
+type sizedClient struct {
+	backup.BackupClient
+	t *testing.T
+}
+
+func (c *sizedClient) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	if opts.Size != int64(len(data)) {
+		c.t.Errorf("upload of %s: size = %d, uploaded %d bytes", name, opts.Size, len(data))
+	}
+
+	return c.BackupClient.Backup(name, bytes.NewReader(data), opts)
+}
+
+func newClient(t *testing.T) backup.BackupClient {
+	t.Helper()
+
+	client, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &sizedClient{client, t}
+}
+
+// Creates a volume with a file spanning several chunks and a repeated chunk
+func newVolume(t *testing.T) (string, []string) {
+	t.Helper()
+
+	volume := t.TempDir()
+	region := bytes.Repeat([]byte("region"), 100)
+	region = append(region, bytes.Repeat([]byte{0}, 512)...)
+	region = append(region, bytes.Repeat([]byte{0}, 512)...)
+
+	if err := os.MkdirAll(filepath.Join(volume, "world", "region"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(volume, "world", "region", "r.0.0.mca"), region, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(volume, "world", "level.dat"), []byte("level"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return volume, []string{"world", "world/level.dat", "world/region", "world/region/r.0.0.mca"}
+}
+
+func TestUploadBlobs(t *testing.T) {
+	client := newClient(t)
+	volume, paths := newVolume(t)
+
+	m, err := Snapshot(volume, paths, nil, UploadBlobs(client), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := SnapshotName("mc", time.Now())
+	if err := UploadManifest(client, m, name); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRestores(t, client, name, volume)
+}
+
+func TestStageBlobs(t *testing.T) {
+	client := newClient(t)
+	volume, paths := newVolume(t)
+	stageDir := t.TempDir()
+
+	m, err := Snapshot(volume, paths, nil, StageBlobs(stageDir), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UploadStaged(client, stageDir); err != nil {
+		t.Fatal(err)
+	}
+
+	name := SnapshotName("mc", time.Now())
+	if err := UploadManifest(client, m, name); err != nil {
+		t.Fatal(err)
+	}
+
+	assertRestores(t, client, name, volume)
+}
+
+func TestSnapshotSkipsKnownBlobs(t *testing.T) {
+	client := newClient(t)
+	volume, paths := newVolume(t)
+
+	first, err := Snapshot(volume, paths, nil, UploadBlobs(client), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	known, err := ListBlobs(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uploaded := 0
+	second, err := Snapshot(volume, paths, known, func(hash string, chunk []byte) error {
+		uploaded++
+		return nil
+	}, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if uploaded != 0 {
+		t.Errorf("unchanged volume uploaded %d blobs", uploaded)
+	}
+	if len(second.Entries) != len(first.Entries) {
+		t.Errorf("second snapshot has %d entries, want %d", len(second.Entries), len(first.Entries))
+	}
+}
+
+func assertRestores(t *testing.T, client backup.BackupClient, name, volume string) {
+	t.Helper()
+
+	if err := Verify(client, name); err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+
+	target := t.TempDir()
+	if err := Restore(client, name, target, nil, nil); err != nil {
+		t.Fatalf("Restore() = %v", err)
+	}
+
+	for _, file := range []string{"world/level.dat", "world/region/r.0.0.mca"} {
+		want, err := os.ReadFile(filepath.Join(volume, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := os.ReadFile(filepath.Join(target, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(got, want) {
+			t.Errorf("restored %s differs from the original", file)
+		}
+	}
+}
+
+func TestUnreferencedWithLease(t *testing.T) {
+	dir := t.TempDir()
+	client, err := local.New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	volume, paths := newVolume(t)
+	if _, err := Snapshot(volume, paths, nil, UploadBlobs(client), 512); err != nil {
+		t.Fatal(err)
+	}
+
+	// blobs left unreferenced by a pruned snapshot long ago
+	old := time.Now().Add(-24 * time.Hour)
+	blobs, err := client.List(BlobPrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, blob := range blobs {
+		if err := os.Chtimes(filepath.Join(dir, blob.Name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	release, err := Lease(client, "mc", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Unreferenced(client, time.Hour, time.Now()); err == nil {
+		t.Error("Unreferenced() returned blobs while a snapshot is in progress")
+	}
+
+	if err := release(); err != nil {
+		t.Fatal(err)
+	}
+
+	unreferenced, err := Unreferenced(client, time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unreferenced) != len(blobs) {
+		t.Errorf("Unreferenced() = %d blobs, want %d", len(unreferenced), len(blobs))
+	}
+
+	// leases of backups that didn't finish expire
+	if _, err := Lease(client, "mc", old); err != nil {
+		t.Fatal(err)
+	}
+	leases, err := client.List(LeasePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lease := range leases {
+		if err := os.Chtimes(filepath.Join(dir, lease.Name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unreferenced, err = Unreferenced(client, time.Hour, time.Now())
+	if err != nil {
+		t.Fatalf("Unreferenced() = %v with an expired lease", err)
+	}
+	if len(unreferenced) != len(blobs)+1 {
+		t.Errorf("Unreferenced() = %d objects, want %d blobs and the expired lease", len(unreferenced), len(blobs))
+	}
+}
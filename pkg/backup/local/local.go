@@ -0,0 +1,148 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Backup client that stores archives in a directory on the local filesystem (e.g. a mounted PersistentVolume)
+type LocalClient struct {
+	dir string
+}
+
+// Creates a new local filesystem client rooted at dir. The directory is created if it does not exist
+func New(dir string) (backup.BackupClient, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalClient{dir}, nil
+}
+
+// Creates a client for an existing directory without creating it, e.g. for sources on a read-only filesystem
+func Open(dir string) (backup.BackupClient, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	return &LocalClient{dir}, nil
+}
+
+func (l *LocalClient) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	target := filepath.Join(l.dir, filepath.Clean("/"+name))
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// write to a temp file first so a partial copy is never visible under the backup name
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func (l *LocalClient) Download(name string, w io.Writer) error {
+	src, err := os.Open(filepath.Join(l.dir, filepath.Clean("/"+name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return backup.NotFound(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	defer src.Close()
+
+	_, err = io.Copy(w, src)
+	return err
+}
+
+func (l *LocalClient) Stat(name string) (backup.Object, error) {
+	info, err := os.Stat(filepath.Join(l.dir, filepath.Clean("/"+name)))
+	if errors.Is(err, os.ErrNotExist) {
+		return backup.Object{}, backup.NotFound(err)
+	}
+	if err != nil {
+		return backup.Object{}, err
+	}
+
+	return backup.Object{Name: name, Size: info.Size(), Created: info.ModTime(), ContentType: contentType(name)}, nil
+}
+
+func (l *LocalClient) List(prefix string) ([]backup.Object, error) {
+	var objs []backup.Object
+
+	err := filepath.Walk(l.dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".tmp-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(l.dir, p)
+		if err != nil {
+			return err
+		}
+
+		name := filepath.ToSlash(rel)
+		if strings.HasPrefix(name, prefix) {
+			objs = append(objs, backup.Object{Name: name, Size: info.Size(), Created: info.ModTime(), ContentType: contentType(name)})
+		}
+
+		return nil
+	})
+
+	return objs, err
+}
+
+func (l *LocalClient) Delete(name string) error {
+	return os.Remove(filepath.Join(l.dir, filepath.Clean("/"+name)))
+}
+
+func (l *LocalClient) Close() error {
+	return nil
+}
+
+// The filesystem doesn't store content types. Archives get the content type of their format, other files the type
+// registered for their extension
+func contentType(name string) string {
+	for _, format := range []backup.Format{backup.ZipFormat, backup.TarGzFormat, backup.TarZstFormat} {
+		if strings.HasSuffix(name, format.Ext()) {
+			return format.ContentType()
+		}
+	}
+
+	// drop parameters such as the charset of text types
+	if t, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(name))); err == nil {
+		return t
+	}
+
+	return ""
+}
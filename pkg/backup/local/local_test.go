@@ -0,0 +1,139 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+func TestBackupAndDownload(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	client, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	world := []byte("level.dat")
+	for _, name := range []string{"mc-server-2021-05-09T03:35:00Z.zip", "mc-server/world.tar.zst", "other/notes.txt"} {
+		if err := client.Backup(name, bytes.NewReader(world), backup.UploadOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := client.Download("mc-server/world.tar.zst", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), world) {
+		t.Errorf("Download() = %q, want %q", buf.Bytes(), world)
+	}
+
+	// names can't escape the directory
+	if err := client.Backup("../escaped.zip", bytes.NewReader(world), backup.UploadOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.zip")); err != nil {
+		t.Errorf("backup outside of the directory: %v", err)
+	}
+
+	if err := client.Delete("../escaped.zip"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat("escaped.zip"); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("Stat() of a deleted backup = %v, want %v", err, backup.ErrNotFound)
+	}
+	if err := client.Download("escaped.zip", &buf); !errors.Is(err, backup.ErrNotFound) {
+		t.Errorf("Download() of a deleted backup = %v, want %v", err, backup.ErrNotFound)
+	}
+}
+
+func TestStatAndList(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"mc-server-2021-05-09T03:35:00Z.zip":     backup.ZipContentType,
+		"mc-server-2021-05-09T03:35:00Z.tar.gz":  backup.TarGzContentType,
+		"mc-server-2021-05-09T03:35:00Z.tar.zst": backup.TarZstContentType,
+		"mc-server/config.json":                  "application/json",
+		"mc-server/server.properties":            "",
+	}
+	for name := range files {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// partial copies are not listed
+	if err := os.WriteFile(filepath.Join(dir, ".tmp-123"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, contentType := range files {
+		obj, err := client.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obj.Name != name || obj.Size != int64(len(name)) || obj.ContentType != contentType {
+			t.Errorf("Stat(%q) = %+v, want size %d and content type %q", name, obj, len(name), contentType)
+		}
+	}
+
+	objs, err := client.List("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != len(files) {
+		t.Errorf("List() returned %d objects, want %d", len(objs), len(files))
+	}
+	for _, obj := range objs {
+		if contentType, ok := files[obj.Name]; !ok || obj.ContentType != contentType {
+			t.Errorf("List() returned %+v, want content type %q", obj, contentType)
+		}
+	}
+
+	objs, err = client.List("mc-server/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objs) != 2 {
+		t.Errorf("List(mc-server/) returned %d objects, want 2", len(objs))
+	}
+	for _, obj := range objs {
+		if !strings.HasPrefix(obj.Name, "mc-server/") {
+			t.Errorf("List(mc-server/) returned %s", obj.Name)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	if _, err := Open(missing); err == nil {
+		t.Error("Open() of a missing directory succeeded")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Open() created the directory: %v", err)
+	}
+
+	file := filepath.Join(t.TempDir(), "world.zip")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(file); err == nil {
+		t.Error("Open() of a file succeeded")
+	}
+}
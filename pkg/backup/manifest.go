@@ -0,0 +1,195 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// Integrity manifests are stored next to their backup as <backup name><ManifestSuffix>
+	ManifestSuffix      = ".manifest.json"
+	ManifestContentType = "application/json"
+
+	manifestVersion = 1
+)
+
+// Integrity manifest of a backup archive
+type Manifest struct {
+	Version int `json:"version"`
+
+	// Backup object name
+	Name string `json:"name"`
+
+	// Pod name, edition and version of the server that was backed up
+	Server        string `json:"server"`
+	Edition       string `json:"edition"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+
+	Created time.Time `json:"created"`
+	Format  Format    `json:"format"`
+
+	// Size and SHA-256 of the archive before encryption
+	ArchiveSize   int64  `json:"archiveSize"`
+	ArchiveSHA256 string `json:"archiveSha256"`
+
+	// Total size of the archived files
+	Size  int64  `json:"size"`
+	Files []File `json:"files"`
+}
+
+// Archived file. Path is the archive entry name
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Returns the name of the manifest of a backup
+func ManifestName(name string) string {
+	return name + ManifestSuffix
+}
+
+// Checks if an object name refers to a backup integrity manifest
+func IsManifest(name string) bool {
+	return strings.HasSuffix(name, ManifestSuffix)
+}
+
+// Creates a manifest for a backup from the checksums returned by Archive and the digest of the archive
+func NewManifest(name string, format Format, files []File, archive *Digest) *Manifest {
+	m := &Manifest{
+		Version:       manifestVersion,
+		Name:          name,
+		Format:        format,
+		ArchiveSize:   archive.Size(),
+		ArchiveSHA256: archive.Sum(),
+		Files:         files,
+	}
+
+	for _, file := range files {
+		m.Size += file.Size
+	}
+
+	return m
+}
+
+// Uploads the manifest next to its backup
+func UploadManifest(client BackupClient, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return client.Backup(ManifestName(m.Name), bytes.NewReader(data), UploadOptions{ContentType: ManifestContentType, Size: int64(len(data))})
+}
+
+// Downloads and decodes the manifest of the backup with the given name
+func ReadManifest(client BackupClient, name string) (*Manifest, error) {
+	var buf bytes.Buffer
+	if err := client.Download(ManifestName(name), &buf); err != nil {
+		return nil, err
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest for %s: %w", name, err)
+	}
+
+	if m.Version != manifestVersion {
+		return nil, fmt.Errorf("unsupported manifest version %d", m.Version)
+	}
+
+	return &m, nil
+}
+
+// Checks the archive at src against the manifest. The archive checksum is checked first,
+// then every file in the archive is hashed and compared without extracting it.
+// Returns an error describing the first mismatch
+func (m *Manifest) Verify(src, contentType string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	digest := NewDigest()
+	_, err = io.Copy(digest, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	if digest.Size() != m.ArchiveSize || digest.Sum() != m.ArchiveSHA256 {
+		return fmt.Errorf("archive checksum mismatch. expected %s (%d bytes), got %s (%d bytes)", m.ArchiveSHA256, m.ArchiveSize, digest.Sum(), digest.Size())
+	}
+
+	expected := make(map[string]File, len(m.Files))
+	for _, f := range m.Files {
+		expected[f.Path] = f
+	}
+
+	err = Walk(src, contentType, func(name string, mode fs.FileMode, r io.Reader) error {
+		if mode.IsDir() {
+			return nil
+		}
+
+		want, ok := expected[name]
+		if !ok {
+			return fmt.Errorf("%s is not in the manifest", name)
+		}
+
+		delete(expected, name)
+
+		digest := NewDigest()
+		if _, err := io.Copy(digest, r); err != nil {
+			return err
+		}
+
+		if digest.Size() != want.Size || digest.Sum() != want.SHA256 {
+			return fmt.Errorf("%s checksum mismatch. expected %s (%d bytes), got %s (%d bytes)", name, want.SHA256, want.Size, digest.Sum(), digest.Size())
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for name := range expected {
+		return fmt.Errorf("%s is missing from the archive", name)
+	}
+
+	return nil
+}
+
+// Writer that computes the size and SHA-256 of everything written to it
+type Digest struct {
+	hash hash.Hash
+	size int64
+}
+
+func NewDigest() *Digest {
+	return &Digest{hash: sha256.New()}
+}
+
+func (d *Digest) Write(p []byte) (int, error) {
+	d.size += int64(len(p))
+	return d.hash.Write(p)
+}
+
+// Returns the number of bytes written
+func (d *Digest) Size() int64 {
+	return d.size
+}
+
+// Returns the hex encoded SHA-256 of the bytes written
+func (d *Digest) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
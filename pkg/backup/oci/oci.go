@@ -0,0 +1,160 @@
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/errdef"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/credentials"
+	"oras.land/oras-go/v2/registry/remote/retry"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Max size of an artifact manifest
+const maxManifestSize = 4 << 20
+
+type Options struct {
+	// Registry credentials. The docker config file ($DOCKER_CONFIG/config.json) is used when empty
+	Username string
+	Password string
+
+	// Use plain HTTP instead of HTTPS, e.g. for a local registry
+	PlainHTTP bool
+}
+
+// Read-only backup client that loads archives stored as OCI artifacts in a registry repository,
+// e.g. pushed with `oras push registry/worlds:v1 world.zip`. Object names are tags or digests.
+// The archive is the first layer of the artifact
+type OCIClient struct {
+	ctx  context.Context
+	repo *remote.Repository
+}
+
+// Creates a client for the repository (registry/name)
+func New(ctx context.Context, repository string, opts Options) (backup.BackupClient, error) {
+	repo, err := remote.NewRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &auth.Client{
+		Client: retry.DefaultClient,
+		Cache:  auth.NewCache(),
+	}
+
+	if opts.Username != "" {
+		client.Credential = auth.StaticCredential(repo.Reference.Registry, auth.Credential{
+			Username: opts.Username,
+			Password: opts.Password,
+		})
+	} else if store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{}); err == nil {
+		client.Credential = credentials.Credential(store)
+	}
+
+	repo.Client = client
+	repo.PlainHTTP = opts.PlainHTTP
+
+	return &OCIClient{ctx, repo}, nil
+}
+
+// Splits an artifact reference (registry/name:tag or registry/name@digest) into the repository and the tag or digest.
+// The tag defaults to latest
+func ParseReference(ref string) (repository, reference string, err error) {
+	parsed, err := registry.ParseReference(ref)
+	if err != nil {
+		return "", "", err
+	}
+
+	reference = parsed.Reference
+	if reference == "" {
+		reference = "latest"
+	}
+
+	return parsed.Registry + "/" + parsed.Repository, reference, nil
+}
+
+func (c *OCIClient) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	return backup.ErrNotSupported
+}
+
+// Downloads the archive layer of the artifact. The layer is checked against its digest
+func (c *OCIClient) Download(name string, w io.Writer) error {
+	layer, err := c.layer(name)
+	if err != nil {
+		return err
+	}
+
+	rc, err := c.repo.Fetch(c.ctx, layer)
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	vr := content.NewVerifyReader(rc, layer)
+	if _, err := io.Copy(w, vr); err != nil {
+		return err
+	}
+
+	return vr.Verify()
+}
+
+// Returns the size and media type of the archive layer of the artifact
+func (c *OCIClient) Stat(name string) (backup.Object, error) {
+	layer, err := c.layer(name)
+	if err != nil {
+		return backup.Object{}, err
+	}
+
+	return backup.Object{Name: name, Size: layer.Size, ContentType: layer.MediaType}, nil
+}
+
+// Fetches the manifest of the artifact with the given tag or digest and returns its first layer
+func (c *OCIClient) layer(reference string) (ocispec.Descriptor, error) {
+	desc, rc, err := c.repo.FetchReference(c.ctx, reference)
+	// names derived from a digest reference, e.g. manifest names, aren't valid references and can't exist
+	if errors.Is(err, errdef.ErrNotFound) || errors.Is(err, errdef.ErrInvalidReference) {
+		return ocispec.Descriptor{}, backup.NotFound(err)
+	}
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	defer rc.Close()
+
+	if desc.MediaType != ocispec.MediaTypeImageManifest {
+		return ocispec.Descriptor{}, fmt.Errorf("%s is a %s. expected an artifact with a %s", reference, desc.MediaType, ocispec.MediaTypeImageManifest)
+	}
+
+	var manifest ocispec.Manifest
+	if err := json.NewDecoder(io.LimitReader(rc, maxManifestSize)).Decode(&manifest); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	if len(manifest.Layers) == 0 {
+		return ocispec.Descriptor{}, fmt.Errorf("artifact %s has no layers", reference)
+	}
+
+	return manifest.Layers[0], nil
+}
+
+func (c *OCIClient) List(prefix string) ([]backup.Object, error) {
+	return nil, backup.ErrNotSupported
+}
+
+func (c *OCIClient) Delete(name string) error {
+	return backup.ErrNotSupported
+}
+
+func (c *OCIClient) Close() error {
+	return nil
+}
@@ -0,0 +1,111 @@
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Serves a repository with one artifact tagged v1 like a registry does
+func newRegistry(t *testing.T, repository string, layer []byte, layerMediaType string) *httptest.Server {
+	t.Helper()
+
+	config := []byte("{}")
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeEmptyJSON, Digest: digest.FromBytes(config), Size: int64(len(config))},
+		Layers:    []ocispec.Descriptor{{MediaType: layerMediaType, Digest: digest.FromBytes(layer), Size: int64(len(layer))}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := map[digest.Digest][]byte{
+		digest.FromBytes(config): config,
+		digest.FromBytes(layer):  layer,
+	}
+
+	serve := func(rw http.ResponseWriter, r *http.Request, mediaType string, data []byte) {
+		rw.Header().Set("Content-Type", mediaType)
+		rw.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		rw.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		if r.Method != http.MethodHead {
+			rw.Write(data)
+		}
+	}
+
+	prefix := "/v2/" + repository + "/"
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch path := r.URL.Path; {
+		case path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case path == prefix+"manifests/v1" || path == prefix+"manifests/"+digest.FromBytes(manifest).String():
+			serve(rw, r, ocispec.MediaTypeImageManifest, manifest)
+		case strings.HasPrefix(path, prefix+"blobs/"):
+			blob, ok := blobs[digest.Digest(strings.TrimPrefix(path, prefix+"blobs/"))]
+			if !ok {
+				http.NotFound(rw, r)
+				return
+			}
+			serve(rw, r, "application/octet-stream", blob)
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+}
+
+func TestDownload(t *testing.T) {
+	world := bytes.Repeat([]byte("level.dat region "), 1000)
+
+	server := newRegistry(t, "worlds", world, "application/zip")
+	defer server.Close()
+
+	repository, reference, err := ParseReference(strings.TrimPrefix(server.URL, "http://") + "/worlds:v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reference != "v1" {
+		t.Errorf("ParseReference() reference = %q, want v1", reference)
+	}
+
+	client, err := New(context.Background(), repository, Options{PlainHTTP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj, err := client.Stat(reference)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if obj.Size != int64(len(world)) || obj.ContentType != "application/zip" {
+		t.Errorf("Stat() = size %d, type %q", obj.Size, obj.ContentType)
+	}
+
+	var buf bytes.Buffer
+	if err := client.Download(reference, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), world) {
+		t.Errorf("downloaded %d bytes that differ from the %d served", buf.Len(), len(world))
+	}
+
+	// manifest names of digest references aren't valid references
+	for _, name := range []string{"v2", backup.ManifestName(digest.FromBytes(world).String())} {
+		if _, err := client.Stat(name); !errors.Is(err, backup.ErrNotFound) {
+			t.Errorf("Stat(%q) = %v, want %v", name, err, backup.ErrNotFound)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Retention policy for pruning old backups. Keep rules follow the grandfather-father-son (GFS) scheme:
+// the newest backup of each of the last N days, weeks and months is kept.
+// A backup is kept when any keep rule selects it. Backups older than MaxAge are always pruned.
+// The newest backup is never pruned
+type RetentionPolicy struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+	MaxAge      time.Duration
+}
+
+// Checks if no retention rules are set
+func (p RetentionPolicy) IsZero() bool {
+	return p == RetentionPolicy{}
+}
+
+func (p RetentionPolicy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0 || p.KeepMonthly > 0
+}
+
+// Returns the backups that should be deleted under the policy, newest first
+func (p RetentionPolicy) Prune(objs []Object, now time.Time) []Object {
+	if p.IsZero() || len(objs) == 0 {
+		return nil
+	}
+
+	sorted := make([]Object, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp().After(sorted[j].Timestamp())
+	})
+
+	keep := make([]bool, len(sorted))
+
+	if p.hasKeepRules() {
+		for i := 0; i < p.KeepLast && i < len(sorted); i++ {
+			keep[i] = true
+		}
+		keepN(sorted, keep, p.KeepDaily, func(t time.Time) string { return t.Format("2006-01-02") })
+		keepN(sorted, keep, p.KeepWeekly, func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-W%02d", y, w)
+		})
+		keepN(sorted, keep, p.KeepMonthly, func(t time.Time) string { return t.Format("2006-01") })
+	} else {
+		for i := range keep {
+			keep[i] = true
+		}
+	}
+
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		for i, obj := range sorted {
+			if obj.Timestamp().Before(cutoff) {
+				keep[i] = false
+			}
+		}
+	}
+
+	// always keep the newest backup
+	keep[0] = true
+
+	var prune []Object
+	for i, obj := range sorted {
+		if !keep[i] {
+			prune = append(prune, obj)
+		}
+	}
+
+	return prune
+}
+
+// Marks the newest backup in each of the first n distinct periods as kept. objs must be sorted newest first
+func keepN(objs []Object, keep []bool, n int, period func(t time.Time) string) {
+	if n <= 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	for i, obj := range objs {
+		key := period(obj.Timestamp().UTC())
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		keep[i] = true
+
+		if len(seen) == n {
+			return
+		}
+	}
+}
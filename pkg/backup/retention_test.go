@@ -0,0 +1,93 @@
+package backup
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	// Sunday, ISO week 13
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	backups := map[string]time.Time{
+		"a": time.Date(2024, 3, 31, 6, 0, 0, 0, time.UTC),   // W13, March
+		"b": time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC),   // W13, March
+		"c": time.Date(2024, 3, 30, 18, 0, 0, 0, time.UTC),  // W13, March
+		"d": time.Date(2024, 3, 29, 18, 0, 0, 0, time.UTC),  // W13, March
+		"e": time.Date(2024, 3, 24, 18, 0, 0, 0, time.UTC),  // W12, March
+		"f": time.Date(2024, 3, 17, 18, 0, 0, 0, time.UTC),  // W11, March
+		"g": time.Date(2024, 2, 29, 18, 0, 0, 0, time.UTC),  // W09, February
+		"h": time.Date(2024, 1, 31, 18, 0, 0, 0, time.UTC),  // W05, January
+		"i": time.Date(2023, 12, 31, 18, 0, 0, 0, time.UTC), // 2023-W52, December
+	}
+
+	// out of order, so Prune has to sort them
+	var objs []Object
+	for _, id := range []string{"e", "a", "i", "c", "g", "b", "h", "d", "f"} {
+		objs = append(objs, Object{Name: Name("mc-server", backups[id], ".zip")})
+	}
+
+	// returns the ids of the pruned backups
+	ids := func(pruned []Object) string {
+		var out []string
+		for _, obj := range pruned {
+			for id, t := range backups {
+				if obj.Name == Name("mc-server", t, ".zip") {
+					out = append(out, id)
+				}
+			}
+		}
+		return strings.Join(out, "")
+	}
+
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   string
+	}{
+		{"no policy", RetentionPolicy{}, ""},
+		{"keep last", RetentionPolicy{KeepLast: 2}, "cdefghi"},
+		{"keep more than exist", RetentionPolicy{KeepLast: 20}, ""},
+		{"daily keeps the newest of each day", RetentionPolicy{KeepDaily: 3}, "befghi"},
+		{"weekly", RetentionPolicy{KeepWeekly: 2}, "bcdfghi"},
+		{"monthly", RetentionPolicy{KeepMonthly: 4}, "bcdef"},
+		// daily keeps a and c, weekly a, e and f, monthly a, g and h
+		{"overlapping GFS rules", RetentionPolicy{KeepDaily: 2, KeepWeekly: 3, KeepMonthly: 3}, "bdi"},
+		{"keep last and daily overlap", RetentionPolicy{KeepLast: 2, KeepDaily: 2}, "defghi"},
+		// backups older than the max age are pruned even when a keep rule selects them
+		{"max age overrides keep rules", RetentionPolicy{KeepLast: 3, KeepMonthly: 12, MaxAge: 30 * 24 * time.Hour}, "defghi"},
+		{"max age without keep rules", RetentionPolicy{MaxAge: 7 * 24 * time.Hour}, "fghi"},
+		{"newest kept when older than max age", RetentionPolicy{MaxAge: time.Hour}, "bcdefghi"},
+		{"keep last doesn't outlive max age", RetentionPolicy{KeepLast: 1, MaxAge: time.Minute}, "bcdefghi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ids(tt.policy.Prune(objs, now)); got != tt.want {
+				t.Errorf("Prune() pruned %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneBucketsInUTC(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	// both were taken on March 30 in UTC, the second one on March 31 in the local time of its name
+	objs := []Object{
+		{Name: "mc-server-2024-03-30T20:00:00Z.zip"},
+		{Name: "mc-server-2024-03-31T01:00:00+02:00.zip"},
+	}
+
+	pruned := RetentionPolicy{KeepDaily: 2}.Prune(objs, now)
+	if len(pruned) != 1 || pruned[0].Name != "mc-server-2024-03-30T20:00:00Z.zip" {
+		t.Errorf("Prune() = %v, want the older backup of March 30", pruned)
+	}
+}
+
+func TestPruneEmpty(t *testing.T) {
+	if pruned := (RetentionPolicy{KeepLast: 1}).Prune(nil, time.Now()); pruned != nil {
+		t.Errorf("Prune() of no backups = %v", pruned)
+	}
+}
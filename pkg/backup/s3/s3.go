@@ -0,0 +1,162 @@
+package s3
+
+import (
+	"context"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// S3-compatible (AWS S3, MinIO, Ceph RGW, etc.) connection options
+type Options struct {
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Insecure        bool
+	// Upload objects in a single request. Requires the object size to be known up front
+	DisableMultipart bool
+
+	// Timeouts, retries and multipart part size. S3 requires parts of at least 5 MiB
+	Transfer backup.TransferOptions
+}
+
+type S3Client struct {
+	ctx              context.Context
+	client           *minio.Client
+	bktName          string
+	disableMultipart bool
+	transfer         backup.TransferOptions
+}
+
+// Creates a new S3 client for the given bucket. Static credentials are used when an access key is given,
+// otherwise credentials are resolved from the environment, shared credentials file or IAM role
+func New(ctx context.Context, bucketName string, opts Options) (backup.BackupClient, error) {
+	var creds *credentials.Credentials
+	if opts.AccessKeyID != "" {
+		creds = credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+
+	transfer := opts.Transfer.WithDefaults()
+
+	transport, err := minio.DefaultTransport(!opts.Insecure)
+	if err != nil {
+		return nil, err
+	}
+
+	// bounds the wait for a response to each request. minio retries requests that time out
+	transport.ResponseHeaderTimeout = transfer.Timeout
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:      creds,
+		Secure:     !opts.Insecure,
+		Region:     opts.Region,
+		Transport:  transport,
+		MaxRetries: transfer.Retries + 1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3Client{ctx, client, bucketName, opts.DisableMultipart, transfer}, nil
+}
+
+// Uploads r in parts of the transfer chunk size. Parts are uploaded in parallel and each part is retried on its own
+func (s *S3Client) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	// -1 uploads an object of unknown size in parts
+	size := int64(-1)
+	if opts.Size > 0 {
+		size = opts.Size
+	}
+
+	_, err := s.client.PutObject(s.ctx, s.bktName, name, r, size, minio.PutObjectOptions{
+		ContentType:           opts.ContentType,
+		PartSize:              uint64(s.transfer.ChunkSize),
+		NumThreads:            uint(s.transfer.Concurrency),
+		ConcurrentStreamParts: true,
+		DisableMultipart:      s.disableMultipart,
+	})
+
+	return err
+}
+
+func (s *S3Client) RequiresContentLength() bool {
+	return s.disableMultipart
+}
+
+// Downloads the object in parallel ranges
+func (s *S3Client) Download(name string, w io.Writer) error {
+	obj, err := s.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	return backup.DownloadRanges(s.ctx, obj.Size, s.transfer, func(ctx context.Context, offset, length int64, w io.Writer) error {
+		opts := minio.GetObjectOptions{}
+		if err := opts.SetRange(offset, offset+length-1); err != nil {
+			return err
+		}
+
+		r, err := s.client.GetObject(ctx, s.bktName, name, opts)
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		_, err = io.Copy(w, r)
+		return err
+	}, w)
+}
+
+func (s *S3Client) Stat(name string) (backup.Object, error) {
+	ctx, cancel := s.transfer.Context(s.ctx)
+	defer cancel()
+
+	info, err := s.client.StatObject(ctx, s.bktName, name, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return backup.Object{}, backup.NotFound(err)
+	}
+	if err != nil {
+		return backup.Object{}, err
+	}
+
+	return backup.Object{Name: info.Key, Size: info.Size, Created: info.LastModified, ContentType: info.ContentType}, nil
+}
+
+func (s *S3Client) List(prefix string) ([]backup.Object, error) {
+	ctx, cancel := s.transfer.Context(s.ctx)
+	defer cancel()
+
+	var objs []backup.Object
+	for info := range s.client.ListObjects(ctx, s.bktName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, info.Err
+		}
+
+		objs = append(objs, backup.Object{Name: info.Key, Size: info.Size, Created: info.LastModified})
+	}
+
+	return objs, nil
+}
+
+func (s *S3Client) Delete(name string) error {
+	ctx, cancel := s.transfer.Context(s.ctx)
+	defer cancel()
+
+	return s.client.RemoveObject(ctx, s.bktName, name, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Client) Close() error {
+	return nil
+}
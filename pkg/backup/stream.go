@@ -0,0 +1,69 @@
+package backup
+
+import (
+	"io"
+	"os"
+)
+
+// Implemented by clients that can only upload objects of a known size
+type ContentLengthRequirer interface {
+	RequiresContentLength() bool
+}
+
+// Checks if the client needs UploadOptions.Size to be set
+func RequiresContentLength(client BackupClient) bool {
+	r, ok := client.(ContentLengthRequirer)
+	return ok && r.RequiresContentLength()
+}
+
+// Uploads the output of write to the client as it is written, without buffering the whole object.
+// The upload is aborted if write returns an error
+func Stream(client BackupClient, name string, opts UploadOptions, write func(w io.Writer) error) error {
+	pr, pw := io.Pipe()
+
+	errc := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err)
+		errc <- err
+	}()
+
+	uploadErr := client.Backup(name, pr, opts)
+
+	// unblocks write if the upload stopped reading early
+	pr.CloseWithError(uploadErr)
+
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	return uploadErr
+}
+
+// Writes the output of write to a temporary file in dir and uploads it once write returns.
+// Used when the client needs the object size up front
+func Spool(client BackupClient, name string, opts UploadOptions, dir string, write func(w io.Writer) error) error {
+	file, err := os.CreateTemp(dir, ".spool-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := write(file); err != nil {
+		return err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	opts.Size = size
+	return client.Backup(name, file, opts)
+}
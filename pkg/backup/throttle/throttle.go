@@ -0,0 +1,103 @@
+package throttle
+
+import (
+	"context"
+	"io"
+
+	"golang.org/x/time/rate"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Backup client that limits the bandwidth of uploads and downloads. Uploads and downloads share the limit
+type Client struct {
+	ctx     context.Context
+	client  backup.BackupClient
+	limiter *rate.Limiter
+}
+
+// Wraps client with a bandwidth limit of bytesPerSecond
+func New(ctx context.Context, client backup.BackupClient, bytesPerSecond int) *Client {
+	return &Client{ctx, client, rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)}
+}
+
+func (c *Client) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	return c.client.Backup(name, &reader{c, r}, opts)
+}
+
+func (c *Client) Download(name string, w io.Writer) error {
+	return c.client.Download(name, &writer{c, w})
+}
+
+func (c *Client) Stat(name string) (backup.Object, error) {
+	return c.client.Stat(name)
+}
+
+func (c *Client) List(prefix string) ([]backup.Object, error) {
+	return c.client.List(prefix)
+}
+
+func (c *Client) Delete(name string) error {
+	return c.client.Delete(name)
+}
+
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+// Forwards the content length requirement of the wrapped client
+func (c *Client) RequiresContentLength() bool {
+	return backup.RequiresContentLength(c.client)
+}
+
+// Waits until n bytes may be transferred. n must not exceed the burst
+func (c *Client) wait(n int) error {
+	return c.limiter.WaitN(c.ctx, n)
+}
+
+type reader struct {
+	c *Client
+	r io.Reader
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.c.limiter.Burst() {
+		p = p[:r.c.limiter.Burst()]
+	}
+
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.c.wait(n); werr != nil {
+			return n, werr
+		}
+	}
+
+	return n, err
+}
+
+type writer struct {
+	c *Client
+	w io.Writer
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for len(p) > 0 {
+		chunk := p[:min(len(p), w.c.limiter.Burst())]
+
+		if err := w.c.wait(len(chunk)); err != nil {
+			return written, err
+		}
+
+		n, err := w.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		p = p[len(chunk):]
+	}
+
+	return written, nil
+}
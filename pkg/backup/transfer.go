@@ -0,0 +1,164 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"time"
+)
+
+// Max delay between retries
+const MaxBackoff = 30 * time.Second
+
+// Transfer settings of the storage backends
+type TransferOptions struct {
+	// Max duration of a single request, e.g. a Stat, an upload chunk or a download range. No limit when 0
+	Timeout time.Duration
+
+	// Number of times a failed request is retried. The delay starts at Backoff and doubles with every retry up to MaxBackoff
+	Retries int
+	Backoff time.Duration
+
+	// Size of upload chunks and download ranges. Each chunk in flight is buffered in memory
+	ChunkSize int64
+
+	// Number of upload chunks and download ranges transferred in parallel
+	Concurrency int
+}
+
+// Returns the options with unset chunk size, concurrency and backoff set to their defaults
+func (o TransferOptions) WithDefaults() TransferOptions {
+	if o.ChunkSize <= 0 {
+		o.ChunkSize = 16 << 20
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 4
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = time.Second
+	}
+	return o
+}
+
+// Returns a context for a single request that is cancelled after the timeout
+func (o TransferOptions) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if o.Timeout > 0 {
+		return context.WithTimeout(ctx, o.Timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Error that Retry returns without retrying, e.g. for a missing object
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Marks err as permanent so Retry doesn't retry it
+func Permanent(err error) error {
+	return &PermanentError{err}
+}
+
+// Runs op until it succeeds, returns a PermanentError, the retries are exhausted or ctx is done. Every attempt gets
+// its own timeout and attempts are spaced by exponential backoff with jitter
+func Retry(ctx context.Context, opts TransferOptions, op func(ctx context.Context) error) error {
+	opts = opts.WithDefaults()
+	backoff := opts.Backoff
+
+	for attempt := 0; ; attempt++ {
+		attemptCtx, cancel := opts.Context(ctx)
+		err := op(attemptCtx)
+		cancel()
+
+		var permanent *PermanentError
+		if errors.As(err, &permanent) {
+			return permanent.Err
+		}
+
+		if err == nil || attempt >= opts.Retries || ctx.Err() != nil {
+			return err
+		}
+
+		// full jitter so parallel requests don't retry in lockstep
+		select {
+		case <-time.After(rand.N(backoff)):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff = min(backoff*2, MaxBackoff)
+	}
+}
+
+// Fetches length bytes of an object starting at offset into w
+type RangeFunc func(ctx context.Context, offset, length int64, w io.Writer) error
+
+// Downloads an object of size bytes in ranges of opts.ChunkSize, fetching up to opts.Concurrency ranges in parallel
+// and writing them to w in order. A failed range is retried on its own, so a dropped connection only restarts that range
+func DownloadRanges(ctx context.Context, size int64, opts TransferOptions, fetch RangeFunc, w io.Writer) error {
+	opts = opts.WithDefaults()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		buf *bytes.Buffer
+		err error
+	}
+
+	// ranges are queued in order. the queue bounds the number of buffered ranges
+	queue := make(chan chan result, opts.Concurrency)
+
+	go func() {
+		defer close(queue)
+
+		for offset := int64(0); offset < size; offset += opts.ChunkSize {
+			length := min(opts.ChunkSize, size-offset)
+
+			res := make(chan result, 1)
+			select {
+			case queue <- res:
+			case <-ctx.Done():
+				return
+			}
+
+			go func() {
+				buf := bytes.NewBuffer(make([]byte, 0, length))
+				err := Retry(ctx, opts, func(ctx context.Context) error {
+					buf.Reset()
+					if err := fetch(ctx, offset, length, buf); err != nil {
+						return err
+					}
+					if int64(buf.Len()) != length {
+						return fmt.Errorf("short read at offset %d. expected %d bytes, got %d", offset, length, buf.Len())
+					}
+					return nil
+				})
+				res <- result{buf, err}
+			}()
+		}
+	}()
+
+	for res := range queue {
+		r := <-res
+		if r.err != nil {
+			return r.err
+		}
+
+		if _, err := r.buf.WriteTo(w); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
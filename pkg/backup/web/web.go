@@ -0,0 +1,191 @@
+package web
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Read-only backup client that downloads archives over HTTP(S), e.g. maps published by their authors.
+// Object names are URLs. Basic auth credentials can be given in the URL
+type WebClient struct {
+	ctx      context.Context
+	client   *http.Client
+	transfer backup.TransferOptions
+}
+
+// Creates a client with the given transfer settings. Servers that support range requests are downloaded in parallel
+// ranges. Other downloads fail once the server sends no data for the transfer timeout
+func New(ctx context.Context, transfer backup.TransferOptions) (backup.BackupClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = transfer.Timeout
+
+	return &WebClient{ctx, &http.Client{Transport: transport}, transfer.WithDefaults()}, nil
+}
+
+func (c *WebClient) Backup(name string, r io.Reader, opts backup.UploadOptions) error {
+	return backup.ErrNotSupported
+}
+
+func (c *WebClient) Download(name string, w io.Writer) error {
+	obj, ranges, err := c.stat(name)
+	if err != nil {
+		return err
+	}
+
+	if ranges && obj.Size > 0 {
+		return backup.DownloadRanges(c.ctx, obj.Size, c.transfer, func(ctx context.Context, offset, length int64, w io.Writer) error {
+			return c.fetchRange(ctx, name, offset, length, w)
+		}, w)
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+
+	// only the request is retried. the body can't be resumed once part of it is written to w
+	var res *http.Response
+	err = backup.Retry(ctx, c.transfer, func(context.Context) error {
+		res, err = c.get(ctx, http.MethodGet, name, nil)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	_, err = io.Copy(w, newIdleReader(res.Body, c.transfer.Timeout, cancel))
+	return err
+}
+
+// Fetches a byte range of the object. Fails if the server ignores the range
+func (c *WebClient) fetchRange(ctx context.Context, name string, offset, length int64, w io.Writer) error {
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)}}
+
+	res, err := c.get(ctx, http.MethodGet, name, header)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("GET %s: range request answered with %s", name, res.Status)
+	}
+
+	_, err = io.Copy(w, res.Body)
+	return err
+}
+
+// Returns the size, content type and modification time reported by the server.
+// Falls back to a GET request for servers that don't support HEAD, e.g. presigned URLs that are only valid for GET
+func (c *WebClient) Stat(name string) (backup.Object, error) {
+	obj, _, err := c.stat(name)
+	return obj, err
+}
+
+// Stat that also reports if the server supports range requests
+func (c *WebClient) stat(name string) (obj backup.Object, ranges bool, err error) {
+	err = backup.Retry(c.ctx, c.transfer, func(ctx context.Context) error {
+		res, err := c.get(ctx, http.MethodHead, name, nil)
+		if err != nil {
+			res, err = c.get(ctx, http.MethodGet, name, nil)
+		}
+		if err != nil {
+			return err
+		}
+
+		res.Body.Close()
+
+		obj = backup.Object{Name: name, Size: res.ContentLength}
+
+		if contentType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type")); err == nil {
+			obj.ContentType = contentType
+		}
+
+		if modified, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+			obj.Created = modified
+		}
+
+		ranges = res.Header.Get("Accept-Ranges") == "bytes"
+		return nil
+	})
+
+	return obj, ranges, err
+}
+
+// Sends a request and returns an error for non 2xx responses. Errors of client errors are permanent
+func (c *WebClient) get(ctx context.Context, method, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		err := fmt.Errorf("%s %s: %s", method, req.URL.Redacted(), res.Status)
+
+		if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone {
+			return nil, backup.Permanent(backup.NotFound(err))
+		}
+
+		// client errors other than timeouts and rate limits fail the same way when retried
+		if res.StatusCode < 500 && res.StatusCode != http.StatusRequestTimeout && res.StatusCode != http.StatusTooManyRequests {
+			return nil, backup.Permanent(err)
+		}
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (c *WebClient) List(prefix string) ([]backup.Object, error) {
+	return nil, backup.ErrNotSupported
+}
+
+func (c *WebClient) Delete(name string) error {
+	return backup.ErrNotSupported
+}
+
+func (c *WebClient) Close() error {
+	return nil
+}
+
+// Calls cancel when a read doesn't return for the timeout, so a stalled download fails instead of hanging.
+// No timeout when it is 0
+type idleReader struct {
+	r       io.Reader
+	timeout time.Duration
+	timer   *time.Timer
+}
+
+func newIdleReader(r io.Reader, timeout time.Duration, cancel func()) io.Reader {
+	if timeout <= 0 {
+		return r
+	}
+
+	return &idleReader{r, timeout, time.AfterFunc(timeout, cancel)}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.timer.Reset(r.timeout)
+	if err != nil {
+		r.timer.Stop()
+	}
+	return n, err
+}
@@ -0,0 +1,147 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+var world = bytes.Repeat([]byte("level.dat region "), 1000)
+
+func newClient(t *testing.T, transfer backup.TransferOptions) backup.BackupClient {
+	t.Helper()
+
+	client, err := New(context.Background(), transfer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"ranges", func(rw http.ResponseWriter, r *http.Request) {
+			// ServeContent answers range requests
+			rw.Header().Set("Content-Type", "application/zip")
+			http.ServeContent(rw, r, "world.zip", time.Now(), bytes.NewReader(world))
+		}},
+		{"no ranges", func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", "application/zip")
+			rw.Header().Set("Content-Length", strconv.Itoa(len(world)))
+			rw.Write(world)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			client := newClient(t, backup.TransferOptions{Timeout: time.Second, ChunkSize: 1000})
+
+			obj, err := client.Stat(server.URL + "/world.zip")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if obj.Size != int64(len(world)) || obj.ContentType != "application/zip" {
+				t.Errorf("Stat() = size %d, type %q", obj.Size, obj.ContentType)
+			}
+
+			var buf bytes.Buffer
+			if err := client.Download(server.URL+"/world.zip", &buf); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), world) {
+				t.Errorf("downloaded %d bytes that differ from the %d served", buf.Len(), len(world))
+			}
+		})
+	}
+}
+
+func TestDownloadStalled(t *testing.T) {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Length", "1000")
+		rw.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			rw.Write(world[:100])
+			rw.(http.Flusher).Flush()
+			<-stop
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	client := newClient(t, backup.TransferOptions{Timeout: 200 * time.Millisecond})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- client.Download(server.URL+"/world.zip", &bytes.Buffer{})
+	}()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Download() of a stalled response succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Download() of a stalled response hangs")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// the first HEAD and GET fail
+		if requests.Add(1) <= 2 {
+			http.Error(rw, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write(world)
+	}))
+	defer server.Close()
+
+	client := newClient(t, backup.TransferOptions{Timeout: time.Second, Retries: 2, Backoff: time.Millisecond})
+
+	var buf bytes.Buffer
+	if err := client.Download(server.URL+"/world.zip", &buf); err != nil {
+		t.Fatalf("Download() = %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), world) {
+		t.Error("downloaded data differs from the served data")
+	}
+}
+
+func TestNotFoundIsNotRetried(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.NotFound(rw, r)
+	}))
+	defer server.Close()
+
+	client := newClient(t, backup.TransferOptions{Timeout: time.Second, Retries: 3, Backoff: time.Millisecond})
+
+	_, err := client.Stat(server.URL + "/missing.zip")
+	if !errors.Is(err, backup.ErrNotFound) || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Stat() = %v, want 404 %v", err, backup.ErrNotFound)
+	}
+
+	// one HEAD and the GET fallback
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests for a missing object, want 2", n)
+	}
+}
@@ -0,0 +1,328 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/rcon"
+)
+
+// Kind of hook
+type Type string
+
+const (
+	// Console command sent to the server over RCON
+	RCONHook Type = "rcon"
+	// Command executed in the container
+	ExecHook Type = "exec"
+	// HTTP request, e.g. to a webhook
+	HTTPHook Type = "http"
+)
+
+// What a failing hook does to the backup
+type FailurePolicy string
+
+const (
+	// Stop at the failing hook. A failing pre-backup hook aborts the backup before anything is archived. A failing
+	// post-backup hook only skips the remaining post-backup hooks, since the backup is already stored
+	FailBackup FailurePolicy = "fail"
+	// Log the error and carry on
+	IgnoreFailure FailurePolicy = "ignore"
+)
+
+// Timeout of hooks that don't set one
+const DefaultTimeout = 30 * time.Second
+
+// Hooks that run before and after every backup
+type Config struct {
+	Pre  []Hook `json:"pre"`
+	Post []Hook `json:"post"`
+}
+
+// Hook command, arguments, URL, headers and body are text/template templates executed with Vars
+type Hook struct {
+	// Name for logging. Defaults to the type
+	Name string `json:"name,omitempty"`
+	Type Type   `json:"type"`
+
+	// rcon: console command
+	Command string `json:"command,omitempty"`
+
+	// exec: program and arguments. The program is not run in a shell
+	Args []string `json:"args,omitempty"`
+
+	// http: request URL, method (default POST), headers and body (default the vars as JSON)
+	URL     string            `json:"url,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+
+	Timeout   Duration      `json:"timeout,omitempty"`
+	OnFailure FailurePolicy `json:"onFailure,omitempty"`
+}
+
+// time.Duration that is a duration string like "30s" in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// Template variables of a hook
+type Vars struct {
+	// pre or post
+	Phase string `json:"phase"`
+
+	// Pod name of the server
+	Server string `json:"server"`
+
+	// Name and size of the uploaded backup. Empty in pre-backup hooks and after a failed backup
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+
+	// Time the backup took, succeeded or failed, and the error of a failed backup. Empty in pre-backup hooks
+	Duration Duration `json:"duration"`
+	Status   string   `json:"status"`
+	Error    string   `json:"error"`
+}
+
+// RCON connection of the server, used by rcon hooks
+type Options struct {
+	Host         string
+	RCONPort     int
+	RCONPassword string
+}
+
+// Parses the hook config and fills in defaults
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid hooks: %w", err)
+	}
+
+	for _, hooks := range [][]Hook{cfg.Pre, cfg.Post} {
+		for i := range hooks {
+			if err := hooks[i].validate(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &cfg, nil
+}
+
+func (h *Hook) validate() error {
+	if h.Name == "" {
+		h.Name = string(h.Type)
+	}
+
+	if h.Timeout <= 0 {
+		h.Timeout = Duration(DefaultTimeout)
+	}
+
+	if h.OnFailure == "" {
+		h.OnFailure = FailBackup
+	}
+
+	if h.OnFailure != FailBackup && h.OnFailure != IgnoreFailure {
+		return fmt.Errorf("hook %s: unknown failure policy %q. must be fail or ignore", h.Name, h.OnFailure)
+	}
+
+	var templates []string
+
+	switch h.Type {
+	case RCONHook:
+		if h.Command == "" {
+			return fmt.Errorf("hook %s: rcon hooks need a command", h.Name)
+		}
+		templates = []string{h.Command}
+	case ExecHook:
+		if len(h.Args) == 0 {
+			return fmt.Errorf("hook %s: exec hooks need args", h.Name)
+		}
+		templates = h.Args
+	case HTTPHook:
+		if h.URL == "" {
+			return fmt.Errorf("hook %s: http hooks need a url", h.Name)
+		}
+		if h.Method == "" {
+			h.Method = http.MethodPost
+		}
+		templates = []string{h.URL, h.Body}
+		for _, v := range h.Headers {
+			templates = append(templates, v)
+		}
+	default:
+		return fmt.Errorf("hook %s: unknown type %q. must be rcon, exec or http", h.Name, h.Type)
+	}
+
+	// catch template errors when the config is loaded rather than when the hook runs
+	for _, text := range templates {
+		if _, err := template.New(h.Name).Parse(text); err != nil {
+			return fmt.Errorf("hook %s: %w", h.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Runs the hooks in order. Stops at the first failing hook whose policy is fail and returns its error.
+// Failures of other hooks are passed to ignored
+func Run(hooks []Hook, vars Vars, opts Options, ignored func(h Hook, err error)) error {
+	for _, h := range hooks {
+		err := h.run(vars, opts)
+		if err == nil {
+			continue
+		}
+
+		err = fmt.Errorf("hook %s: %w", h.Name, err)
+		if h.OnFailure == IgnoreFailure {
+			ignored(h, err)
+			continue
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (h Hook) run(vars Vars, opts Options) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.Timeout))
+	defer cancel()
+
+	switch h.Type {
+	case RCONHook:
+		return h.runRCON(vars, opts)
+	case ExecHook:
+		return h.runExec(ctx, vars)
+	default:
+		return h.runHTTP(ctx, vars)
+	}
+}
+
+func (h Hook) runRCON(vars Vars, opts Options) error {
+	cmd, err := render(h.Command, vars)
+	if err != nil {
+		return err
+	}
+
+	rc, err := rcon.Dial(opts.Host, opts.RCONPort, opts.RCONPassword)
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+
+	_, err = rc.Command(cmd, time.Duration(h.Timeout))
+	return err
+}
+
+func (h Hook) runExec(ctx context.Context, vars Vars) error {
+	args := make([]string, len(h.Args))
+	for i, arg := range h.Args {
+		rendered, err := render(arg, vars)
+		if err != nil {
+			return err
+		}
+		args[i] = rendered
+	}
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (h Hook) runHTTP(ctx context.Context, vars Vars) error {
+	url, err := render(h.URL, vars)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	if h.Body != "" {
+		rendered, err := render(h.Body, vars)
+		if err != nil {
+			return err
+		}
+		body = []byte(rendered)
+	} else if body, err = json.Marshal(vars); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, h.Method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range h.Headers {
+		rendered, err := render(value, vars)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(key, rendered)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+	io.Copy(io.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return errors.New(res.Status)
+	}
+
+	return nil
+}
+
+func render(text string, vars Vars) (string, error) {
+	tmpl, err := template.New("").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, vars); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,380 @@
+package layers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/backup"
+)
+
+// Layers are archives, files or directories applied on top of the server volume in order, e.g. datapacks,
+// resource packs, plugin jars and config overlays. Applied layers are recorded in a lockfile in the volume
+// so they are not applied again when load reruns
+
+// Name of the lockfile in the volume
+const LockfileName = ".agones-mc-layers.json"
+
+// Kind of layer source
+type Type string
+
+const (
+	// Archive extracted into the target directory
+	ArchiveLayer Type = "archive"
+	// File copied as is. The target is the file path, or a directory when it ends in a slash or is the volume root
+	FileLayer Type = "file"
+	// Every object under a storage prefix or in a directory, copied to the target directory
+	DirectoryLayer Type = "directory"
+)
+
+// What to do with files that already exist in the target
+type Overwrite string
+
+const (
+	// Overwrite existing files
+	OverwriteAlways Overwrite = "always"
+	// Keep existing files
+	OverwriteNever Overwrite = "never"
+	// Delete the target before applying the layer
+	OverwriteReplace Overwrite = "replace"
+)
+
+type Layer struct {
+	// Name for logging. Defaults to the source
+	Name string `json:"name,omitempty"`
+
+	// Backup name in the storage backend or source URL. Sources ending in a slash are directories
+	Source string `json:"source"`
+
+	// Path in the volume to apply the layer to. Defaults to the volume root
+	Target string `json:"target,omitempty"`
+
+	Type      Type      `json:"type,omitempty"`
+	Overwrite Overwrite `json:"overwrite,omitempty"`
+
+	// Expected SHA-256 of archive and file layers
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// Parses a JSON list of layers and fills in defaults
+func Parse(data []byte) ([]Layer, error) {
+	var layers []Layer
+	if err := json.Unmarshal(data, &layers); err != nil {
+		return nil, fmt.Errorf("invalid layers: %w", err)
+	}
+
+	for i := range layers {
+		l := &layers[i]
+
+		if l.Source == "" {
+			return nil, fmt.Errorf("layer %d has no source", i)
+		}
+
+		if l.Name == "" {
+			l.Name = l.Source
+		}
+
+		if l.Target == "" {
+			l.Target = "."
+		}
+
+		if _, err := backup.SafeJoin("", l.Target); err != nil {
+			return nil, fmt.Errorf("layer %s: invalid target: %w", l.Name, err)
+		}
+
+		if l.Type == "" {
+			l.Type = ArchiveLayer
+			if strings.HasSuffix(l.Source, "/") {
+				l.Type = DirectoryLayer
+			}
+		}
+
+		if l.Overwrite == "" {
+			l.Overwrite = OverwriteAlways
+		}
+
+		switch l.Type {
+		case ArchiveLayer, FileLayer, DirectoryLayer:
+		default:
+			return nil, fmt.Errorf("layer %s: unknown type %q. must be archive, file or directory", l.Name, l.Type)
+		}
+
+		switch l.Overwrite {
+		case OverwriteAlways, OverwriteNever, OverwriteReplace:
+		default:
+			return nil, fmt.Errorf("layer %s: unknown overwrite policy %q. must be always, never or replace", l.Name, l.Overwrite)
+		}
+
+		if l.Overwrite == OverwriteReplace && l.replacesRoot() {
+			return nil, fmt.Errorf("layer %s: overwrite policy replace would delete the whole volume. set a target directory", l.Name)
+		}
+	}
+
+	return layers, nil
+}
+
+// Returns a hash of the layer config. A layer is applied again when its config changes
+func (l Layer) Key() string {
+	data, _ := json.Marshal(l)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Record of the layers applied to a volume
+type Lock struct {
+	Layers []Applied `json:"layers"`
+}
+
+type Applied struct {
+	Layer
+	Key     string    `json:"key"`
+	Applied time.Time `json:"applied"`
+	// SHA-256 of the applied archive or file
+	Digest string `json:"digest,omitempty"`
+}
+
+// Reads the lockfile in the volume. Returns an empty lock if there is none
+func ReadLock(volume string) (*Lock, error) {
+	data, err := os.ReadFile(filepath.Join(volume, LockfileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return &Lock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var lock Lock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("invalid layer lockfile: %w", err)
+	}
+
+	return &lock, nil
+}
+
+// Writes the lockfile to the volume
+func (lock *Lock) Write(volume string) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAtomic(filepath.Join(volume, LockfileName), func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// Returns the number of leading layers that were already applied in the same order with the same config.
+// Layers after the first changed layer are applied again since they may overwrite its files
+func (lock *Lock) Applied(layers []Layer) int {
+	n := 0
+	for n < len(layers) && n < len(lock.Layers) && lock.Layers[n].Key == layers[n].Key() {
+		n++
+	}
+	return n
+}
+
+// Records layer as the i-th applied layer, dropping the records of the layers after it
+func (lock *Lock) Record(i int, layer Layer, digest string, now time.Time) {
+	lock.Layers = append(lock.Layers[:i], Applied{Layer: layer, Key: layer.Key(), Applied: now, Digest: digest})
+}
+
+// Applies the layer to the volume. name is the object name of the layer source in client, or the prefix for directory layers.
+// Returns the SHA-256 of archive and file layers
+func Apply(client backup.BackupClient, name string, layer Layer, volume string) (string, error) {
+	target, err := backup.SafeJoin(volume, layer.Target)
+	if err != nil {
+		return "", err
+	}
+
+	if layer.Overwrite == OverwriteReplace {
+		if layer.replacesRoot() {
+			return "", fmt.Errorf("layer %s: overwrite policy replace would delete the whole volume", layer.Name)
+		}
+
+		// keep the target of a file layer that is a directory
+		if layer.Type != FileLayer || !layer.targetIsDir() {
+			if err := os.RemoveAll(target); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	switch layer.Type {
+	case FileLayer:
+		if layer.targetIsDir() {
+			target = filepath.Join(target, sourceBase(name))
+		}
+
+		return applyFile(client, name, layer, target)
+	case DirectoryLayer:
+		return "", applyDirectory(client, name, layer, target)
+	default:
+		return applyArchive(client, name, layer, volume, target)
+	}
+}
+
+func applyArchive(client backup.BackupClient, name string, layer Layer, volume, target string) (string, error) {
+	obj, err := client.Stat(name)
+	if err != nil {
+		return "", err
+	}
+
+	// Download to the volume. the image may not have a writable temp dir
+	file, err := os.CreateTemp(volume, ".layer-*")
+	if err != nil {
+		return "", err
+	}
+
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	digest := backup.NewDigest()
+	if err := client.Download(name, io.MultiWriter(file, digest)); err != nil {
+		return "", err
+	}
+
+	if err := verify(layer, digest); err != nil {
+		return "", err
+	}
+
+	err = backup.Extract(file.Name(), target, obj.ContentType, backup.ExtractOptions{
+		KeepExisting: layer.Overwrite == OverwriteNever,
+	})
+
+	return digest.Sum(), err
+}
+
+func applyFile(client backup.BackupClient, name string, layer Layer, target string) (string, error) {
+	if layer.Overwrite == OverwriteNever && exists(target) {
+		return "", nil
+	}
+
+	digest := backup.NewDigest()
+	err := writeAtomic(target, func(w io.Writer) error {
+		if err := client.Download(name, io.MultiWriter(w, digest)); err != nil {
+			return err
+		}
+		return verify(layer, digest)
+	})
+
+	return digest.Sum(), err
+}
+
+func applyDirectory(client backup.BackupClient, prefix string, layer Layer, target string) error {
+	// list the directory, not every object whose name starts with it
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	objs, err := client.List(prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, obj := range objs {
+		rel := strings.TrimPrefix(obj.Name, prefix)
+
+		// skip directory placeholders and integrity manifests
+		if rel == "" || strings.HasSuffix(rel, "/") || backup.IsManifest(rel) {
+			continue
+		}
+
+		dest, err := backup.SafeJoin(target, rel)
+		if err != nil {
+			return err
+		}
+
+		if layer.Overwrite == OverwriteNever && exists(dest) {
+			continue
+		}
+
+		err = writeAtomic(dest, func(w io.Writer) error {
+			return client.Download(obj.Name, w)
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", obj.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// Checks if the layer's target is the volume root
+func (l Layer) targetIsRoot() bool {
+	return l.Target == "" || filepath.Clean(filepath.FromSlash(l.Target)) == "."
+}
+
+// Checks if the target of a file layer is a directory the file is copied into
+func (l Layer) targetIsDir() bool {
+	return strings.HasSuffix(l.Target, "/") || l.targetIsRoot()
+}
+
+// Checks if replacing the target deletes the whole volume. File layers copied into the root only replace their file
+func (l Layer) replacesRoot() bool {
+	return l.Type != FileLayer && l.targetIsRoot()
+}
+
+// Checks the digest of a downloaded layer against its pinned checksum
+func verify(layer Layer, digest *backup.Digest) error {
+	if layer.SHA256 == "" {
+		return nil
+	}
+
+	if want := strings.TrimPrefix(layer.SHA256, "sha256:"); !strings.EqualFold(want, digest.Sum()) {
+		return fmt.Errorf("layer %s checksum mismatch. expected sha256:%s, got sha256:%s", layer.Name, want, digest.Sum())
+	}
+
+	return nil
+}
+
+// Returns the file name of an object name or URL
+func sourceBase(name string) string {
+	if u, err := url.Parse(name); err == nil && u.Scheme != "" {
+		name = u.Path
+	}
+	return path.Base(name)
+}
+
+// Writes a file through a temp file in the same directory so a partial file is never visible under its name
+func writeAtomic(target string, write func(w io.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), target)
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,106 @@
+package layers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raefon/agones-mc/pkg/backup/local"
+)
+
+func TestParseReplaceRoot(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"archive into root", `[{"source": "world.zip", "overwrite": "replace"}]`, true},
+		{"archive into dot", `[{"source": "world.zip", "target": "./", "overwrite": "replace"}]`, true},
+		{"directory into cleaned root", `[{"source": "plugins/", "target": "plugins/..", "overwrite": "replace"}]`, true},
+		{"archive into subdirectory", `[{"source": "world.zip", "target": "world", "overwrite": "replace"}]`, false},
+		{"file into root", `[{"source": "server.properties", "type": "file", "overwrite": "replace"}]`, false},
+		{"archive into root without replace", `[{"source": "world.zip"}]`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApplyReplaceRoot(t *testing.T) {
+	volume := t.TempDir()
+	writeFile(t, filepath.Join(volume, "world", "level.dat"), "level")
+
+	client, err := local.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	layer := Layer{Name: "world", Source: "world.zip", Target: ".", Type: ArchiveLayer, Overwrite: OverwriteReplace}
+	if _, err := Apply(client, "world.zip", layer, volume); err == nil {
+		t.Fatal("Apply() replaced the volume root")
+	}
+
+	if _, err := os.Stat(filepath.Join(volume, "world", "level.dat")); err != nil {
+		t.Errorf("volume was modified: %v", err)
+	}
+}
+
+func TestApplyFileIntoRoot(t *testing.T) {
+	volume := t.TempDir()
+	source := t.TempDir()
+	writeFile(t, filepath.Join(source, "config", "server.properties"), "motd=layer")
+	writeFile(t, filepath.Join(volume, "server.properties"), "motd=old")
+	writeFile(t, filepath.Join(volume, "world", "level.dat"), "level")
+
+	client, err := local.New(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{"", ".", "./"} {
+		for _, overwrite := range []Overwrite{OverwriteAlways, OverwriteReplace} {
+			layer := Layer{Name: "properties", Source: "config/server.properties", Target: target, Type: FileLayer, Overwrite: overwrite}
+			if _, err := Apply(client, layer.Source, layer, volume); err != nil {
+				t.Fatalf("Apply(target %q, overwrite %s) = %v", target, overwrite, err)
+			}
+
+			if got := readFile(t, filepath.Join(volume, "server.properties")); got != "motd=layer" {
+				t.Errorf("Apply(target %q, overwrite %s) wrote %q", target, overwrite, got)
+			}
+
+			if got := readFile(t, filepath.Join(volume, "world", "level.dat")); got != "level" {
+				t.Errorf("Apply(target %q, overwrite %s) modified the world", target, overwrite)
+			}
+
+			writeFile(t, filepath.Join(volume, "server.properties"), "motd=old")
+		}
+	}
+}
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,269 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "agones_mc"
+
+// Results of pings, SDK calls and backups
+const (
+	success = "success"
+	failure = "failure"
+)
+
+// monitor metrics
+var (
+	pingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ping_duration_seconds",
+		Help:      "Latency of server pings.",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"result"})
+
+	pingConsecutiveFailures = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "ping_consecutive_failures",
+		Help:      "Failed pings since the last successful one.",
+	})
+
+	playersOnline = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "players_online",
+		Help:      "Players online as of the last successful ping.",
+	})
+
+	playersMax = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "players_max",
+		Help:      "Player limit as of the last successful ping.",
+	})
+
+	serverInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "server_info",
+		Help:      "Version of the server. Always 1.",
+	}, []string{"version", "protocol"})
+
+	sdkCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sdk_calls_total",
+		Help:      "Calls to the Agones SDK server.",
+	}, []string{"call", "result"})
+
+	tps = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "tps",
+		Help:      "Ticks per second as of the last tick rate query.",
+	})
+
+	mspt = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "mspt",
+		Help:      "Milliseconds per tick as of the last tick rate query.",
+	})
+
+	lagging = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "lagging",
+		Help:      "1 if the tick rate is past the lag thresholds, 0 otherwise.",
+	})
+)
+
+// backup metrics
+var (
+	backupLastSuccess = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_success_timestamp_seconds",
+		Help:      "Unix time of the last successful backup.",
+	})
+
+	backupLastDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_duration_seconds",
+		Help:      "Duration of the last backup, successful or not.",
+	})
+
+	backupLastSize = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "backup_last_size_bytes",
+		Help:      "Size of the last successful backup.",
+	})
+
+	backups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backups_total",
+		Help:      "Backups by result.",
+	}, []string{"result"})
+)
+
+// fileserver metrics
+var (
+	fileServerRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fileserver_requests_total",
+		Help:      "File server requests by method and status code.",
+	}, []string{"method", "code"})
+
+	fileServerBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "fileserver_bytes_total",
+		Help:      "Bytes received in request bodies and sent in responses.",
+	}, []string{"direction"})
+)
+
+// Registers the monitor metrics
+func RegisterMonitor() {
+	prometheus.MustRegister(pingDuration, pingConsecutiveFailures, playersOnline, playersMax, serverInfo, sdkCalls, tps, mspt, lagging)
+}
+
+// Registers the backup metrics
+func RegisterBackup() {
+	prometheus.MustRegister(backupLastSuccess, backupLastDuration, backupLastSize, backups)
+	// create the series so failures show up as an increase from 0
+	backups.WithLabelValues(success)
+	backups.WithLabelValues(failure)
+}
+
+// Registers the file server metrics
+func RegisterFileServer() {
+	prometheus.MustRegister(fileServerRequests, fileServerBytes)
+}
+
+// Handler serving the registered metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// Creates a server for the registered metrics on addr at /metrics
+func NewServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	return &http.Server{Addr: addr, Handler: mux}
+}
+
+// Records a ping and its latency. Failed pings count towards the consecutive failures, successful ones reset them
+func ObservePing(d time.Duration, err error) {
+	if err != nil {
+		pingDuration.WithLabelValues(failure).Observe(d.Seconds())
+		pingConsecutiveFailures.Inc()
+		return
+	}
+
+	pingDuration.WithLabelValues(success).Observe(d.Seconds())
+	pingConsecutiveFailures.Set(0)
+}
+
+// Records the player counts and version reported by a ping
+func ObserveServer(online, max int32, version string, protocol int32) {
+	playersOnline.Set(float64(online))
+	playersMax.Set(float64(max))
+
+	// drop the series of the previous version after an upgrade
+	serverInfo.Reset()
+	serverInfo.WithLabelValues(version, strconv.Itoa(int(protocol))).Set(1)
+}
+
+// Records a call to the Agones SDK server, e.g. Ready or Health
+func ObserveSDKCall(call string, err error) {
+	sdkCalls.WithLabelValues(call, result(err)).Inc()
+}
+
+// Records a tick rate query. Unknown values are zero and aren't recorded
+func ObserveTick(ticksPerSecond, msPerTick float64, lag bool) {
+	if ticksPerSecond > 0 {
+		tps.Set(ticksPerSecond)
+	}
+
+	if msPerTick > 0 {
+		mspt.Set(msPerTick)
+	}
+
+	if lag {
+		lagging.Set(1)
+	} else {
+		lagging.Set(0)
+	}
+}
+
+// Records a backup. The size is only recorded for successful backups
+func ObserveBackup(d time.Duration, size int64, err error) {
+	backupLastDuration.Set(d.Seconds())
+	backups.WithLabelValues(result(err)).Inc()
+
+	if err != nil {
+		return
+	}
+
+	backupLastSuccess.SetToCurrentTime()
+	backupLastSize.Set(float64(size))
+}
+
+// Wraps a file server handler, counting its requests and the bytes it transfers
+func InstrumentFileServer(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		res := &responseWriter{ResponseWriter: rw, code: http.StatusOK}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+
+		h.ServeHTTP(res, r)
+
+		fileServerRequests.WithLabelValues(r.Method, strconv.Itoa(res.code)).Inc()
+		fileServerBytes.WithLabelValues("received").Add(float64(body.n))
+		fileServerBytes.WithLabelValues("sent").Add(float64(res.n))
+	})
+}
+
+func result(err error) string {
+	if err != nil {
+		return failure
+	}
+	return success
+}
+
+// Records the status code and counts the bytes of a response
+type responseWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+	n           int64
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.code = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Lets http.ResponseController reach the wrapped writer, e.g. to flush streamed downloads
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
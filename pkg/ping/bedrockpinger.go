@@ -26,12 +26,7 @@ func (p *BedrockPinger) Ping() (*ServerInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ServerInfo{
-		Protocol:      int32(res.ProtocolVersion),
-		Version:       res.MCPEVersion,
-		MaxPlayers:    int32(res.MaxPlayers),
-		OnlinePlayers: int32(res.PlayerCount),
-	}, nil
+	return bedrockInfo(res), nil
 }
 
 // Pings the bedrock minecraft server and returns server info. Returns error on failed ping or timeout
@@ -40,12 +35,25 @@ func (p *BedrockPinger) PingWithTimeout() (*ServerInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &ServerInfo{
+	return bedrockInfo(res), nil
+}
+
+// Converts a pong to a ServerInfo. The fields after the player limit are the server ID, level name and game mode
+func bedrockInfo(res bedrockping.Response) *ServerInfo {
+	info := &ServerInfo{
 		Protocol:      int32(res.ProtocolVersion),
 		Version:       res.MCPEVersion,
 		MaxPlayers:    int32(res.MaxPlayers),
 		OnlinePlayers: int32(res.PlayerCount),
-	}, nil
+		MOTD:          plainText(res.ServerName),
+	}
+
+	if len(res.Extra) > 2 {
+		info.LevelName = res.Extra[1]
+		info.GameMode = res.Extra[2]
+	}
+
+	return info
 }
 
 // Checks if the current timeout duration is zero
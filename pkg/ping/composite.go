@@ -0,0 +1,160 @@
+package ping
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/raefon/agones-mc/internal/config"
+)
+
+// Checks of READY_CHECKS and HEALTH_CHECKS
+const (
+	StatusCheck = "status"
+	QueryCheck  = "query"
+	RCONCheck   = "rcon"
+)
+
+// Pinger that runs several named checks, e.g. a status ping and an RCON round-trip. All checks must pass.
+// The info of the checks is merged, with fields of earlier checks taking precedence
+type CompositePinger struct {
+	Names   []string
+	Pingers []Pinger
+}
+
+// Creates the pingers for the ready and health checks of the config. Checks used by both share a pinger
+func NewChecks(cfg config.MonitorConfig) (ready, health *CompositePinger, err error) {
+	pingers := map[string]Pinger{}
+
+	build := func(names []string) (*CompositePinger, error) {
+		if len(names) == 0 {
+			return nil, errors.New("no checks configured")
+		}
+
+		composite := &CompositePinger{Names: names}
+		for _, name := range names {
+			pinger, ok := pingers[name]
+			if !ok {
+				if pinger, err = newCheck(name, cfg); err != nil {
+					return nil, err
+				}
+				pingers[name] = pinger
+			}
+
+			composite.Pingers = append(composite.Pingers, pinger)
+		}
+
+		return composite, nil
+	}
+
+	if ready, err = build(cfg.GetReadyChecks()); err != nil {
+		return nil, nil, err
+	}
+
+	if health, err = build(cfg.GetHealthChecks()); err != nil {
+		return nil, nil, err
+	}
+
+	return ready, health, nil
+}
+
+func newCheck(name string, cfg config.MonitorConfig) (Pinger, error) {
+	switch name {
+	case StatusCheck:
+		if cfg.GetEdition() == config.BedrockEdition {
+			return &BedrockPinger{Host: cfg.GetHost(), Port: uint16(cfg.GetPort()), Timeout: cfg.GetTimeout()}, nil
+		}
+		return &McPinger{Host: cfg.GetHost(), Port: uint16(cfg.GetPort()), Timeout: cfg.GetTimeout()}, nil
+	case QueryCheck:
+		return &QueryPinger{Host: cfg.GetHost(), Port: uint16(cfg.GetQueryPort()), Timeout: cfg.GetTimeout()}, nil
+	case RCONCheck:
+		return &RCONPinger{Host: cfg.GetHost(), Port: cfg.GetRCONPort(), Password: cfg.GetRCONPassword(), Command: cfg.GetRCONCheckCommand(), Timeout: cfg.GetTimeout()}, nil
+	default:
+		return nil, fmt.Errorf("unknown check %q. must be status, query or rcon", name)
+	}
+}
+
+// Adds a check that runs after the others
+func (p *CompositePinger) Add(name string, pinger Pinger) {
+	p.Names = append(p.Names, name)
+	p.Pingers = append(p.Pingers, pinger)
+}
+
+// Runs the checks without timeouts. Returns the error of the first failing check
+func (p *CompositePinger) Ping() (*ServerInfo, error) {
+	return p.run(Pinger.Ping)
+}
+
+// Runs the checks with their timeouts. Returns the error of the first failing check
+func (p *CompositePinger) PingWithTimeout() (*ServerInfo, error) {
+	return p.run(Pinger.PingWithTimeout)
+}
+
+// Checks if any check reports the player limit
+func (p *CompositePinger) ReportsPlayers() bool {
+	for _, pinger := range p.Pingers {
+		if ReportsPlayers(pinger) {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the timeout of any check is zero
+func (p *CompositePinger) IsTimeoutZero() bool {
+	for _, pinger := range p.Pingers {
+		if pinger.IsTimeoutZero() {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *CompositePinger) run(ping func(Pinger) (*ServerInfo, error)) (*ServerInfo, error) {
+	info := &ServerInfo{}
+
+	for i, pinger := range p.Pingers {
+		res, err := ping(pinger)
+		if err != nil {
+			return nil, fmt.Errorf("%s check failed: %w", p.Names[i], err)
+		}
+
+		info.merge(res)
+	}
+
+	return info, nil
+}
+
+// Fills the unset fields of info with those of other
+func (info *ServerInfo) merge(other *ServerInfo) {
+	if info.Protocol == 0 {
+		info.Protocol = other.Protocol
+	}
+	if info.Version == "" {
+		info.Version = other.Version
+	}
+	if info.MaxPlayers == 0 {
+		info.MaxPlayers = other.MaxPlayers
+		info.OnlinePlayers = other.OnlinePlayers
+	}
+	if info.Players == nil {
+		info.Players = other.Players
+	}
+	if info.MOTD == "" {
+		info.MOTD = other.MOTD
+	}
+	if info.GameMode == "" {
+		info.GameMode = other.GameMode
+	}
+	if info.LevelName == "" {
+		info.LevelName = other.LevelName
+	}
+	if info.Mods == nil {
+		info.Mods = other.Mods
+	}
+	if info.PlayerNames == nil {
+		info.PlayerNames = other.PlayerNames
+	}
+	if info.Plugins == nil {
+		info.Plugins = other.Plugins
+	}
+}
@@ -0,0 +1,28 @@
+package ping
+
+import "testing"
+
+func TestReportsPlayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		pinger Pinger
+		want   bool
+	}{
+		{"status", &McPinger{}, true},
+		{"query", &QueryPinger{}, true},
+		{"rcon default", &RCONPinger{}, true},
+		{"rcon list", &RCONPinger{Command: "list uuids"}, true},
+		{"rcon namespaced list", &RCONPinger{Command: "minecraft:list"}, true},
+		{"rcon other command", &RCONPinger{Command: "seed"}, false},
+		{"composite with status", &CompositePinger{Pingers: []Pinger{&RCONPinger{Command: "seed"}, &McPinger{}}}, true},
+		{"composite without status", &CompositePinger{Pingers: []Pinger{&RCONPinger{Command: "seed"}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReportsPlayers(tt.pinger); got != tt.want {
+				t.Errorf("ReportsPlayers() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,47 +1,185 @@
 package ping
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	mcpinger "github.com/Raqbit/mc-pinger"
+	enc "github.com/Raqbit/mc-pinger/encoding"
+	"github.com/Raqbit/mc-pinger/packet"
 )
 
-// Minecraft server pinger using mc-pinger
+// ID of the placeholder players in the sample of servers that hide their players
+const anonymousPlayer = "00000000-0000-0000-0000-000000000000"
+
+// Minecraft formatting codes, e.g. §a
+var formattingCodes = regexp.MustCompile("§.")
+
+// Minecraft server pinger using the mc-pinger protocol implementation
 type McPinger struct {
 	Port    uint16
 	Host    string
 	Timeout time.Duration
 }
 
+// Status response of Java servers, including the mod lists of Forge servers
+type javaStatus struct {
+	Version struct {
+		Name     string `json:"name"`
+		Protocol int32  `json:"protocol"`
+	} `json:"version"`
+	Players     mcpinger.Players       `json:"players"`
+	Description mcpinger.ChatComponent `json:"description"`
+
+	// Forge 1.13+
+	ForgeData *struct {
+		Mods []struct {
+			ModID   string `json:"modId"`
+			Version string `json:"modmarker"`
+		} `json:"mods"`
+	} `json:"forgeData"`
+
+	// Forge 1.12 and older
+	ModInfo *struct {
+		ModList []struct {
+			ModID   string `json:"modid"`
+			Version string `json:"version"`
+		} `json:"modList"`
+	} `json:"modinfo"`
+}
+
 // Pings minecraft server and returns info obj. Returns error on failed ping
 func (p *McPinger) Ping() (*ServerInfo, error) {
-	res, err := mcpinger.New(p.Host, p.Port).Ping()
-	if err != nil {
-		return nil, err
-	}
-	return &ServerInfo{
-		Protocol:      res.Version.Protocol,
-		Version:       res.Version.Name,
-		MaxPlayers:    res.Players.Max,
-		OnlinePlayers: res.Players.Online,
-	}, nil
+	return p.status(0)
 }
 
 // Pings minecraft server and return info obj. Return error on failed ping or timed out context
 func (p *McPinger) PingWithTimeout() (*ServerInfo, error) {
-	res, err := mcpinger.NewTimed(p.Host, p.Port, p.Timeout).Ping()
+	return p.status(p.Timeout)
+}
+
+// Checks if the current timeout duration is zero
+func (p *McPinger) IsTimeoutZero() bool {
+	return p.Timeout == 0
+}
+
+// Requests the server's status. A zero timeout waits indefinitely
+func (p *McPinger) status(timeout time.Duration) (*ServerInfo, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))))
+	if err != nil {
+		return nil, errors.New("could not connect to Minecraft server: " + err.Error())
+	}
+
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	handshake := &packet.HandshakePacket{
+		ProtoVer:   mcpinger.UnknownProtoVersion,
+		ServerAddr: enc.String(p.Host),
+		ServerPort: enc.UnsignedShort(p.Port),
+		NextState:  mcpinger.StatusState,
+	}
+
+	if err := packet.WritePacket(handshake, w); err != nil {
+		return nil, err
+	}
+
+	if err := packet.WritePacket(&packet.RequestPacket{}, w); err != nil {
+		return nil, err
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+
+	rd := bufio.NewReader(conn)
+	res := &packet.ResponsePacket{}
+
+	_, id, err := packet.ReadPacketHeader(rd)
 	if err != nil {
 		return nil, err
 	}
+
+	if id != res.ID() {
+		return nil, fmt.Errorf("received invalid packet. expected #%d, got #%d", res.ID(), id)
+	}
+
+	if err := res.Unmarshal(rd); err != nil {
+		return nil, err
+	}
+
+	var status javaStatus
+	if err := json.Unmarshal([]byte(res.Json), &status); err != nil {
+		return nil, err
+	}
+
+	return status.serverInfo(), nil
+}
+
+// Converts a status response to a ServerInfo
+func (s *javaStatus) serverInfo() *ServerInfo {
+	var players []string
+	for _, p := range s.Players.Sample {
+		// skip the placeholder entries of servers that hide their players
+		if p.ID != "" && p.ID != anonymousPlayer {
+			players = append(players, p.ID)
+		}
+	}
+
+	var mods []string
+	if s.ForgeData != nil {
+		for _, mod := range s.ForgeData.Mods {
+			mods = append(mods, mod.ModID+"@"+mod.Version)
+		}
+	} else if s.ModInfo != nil {
+		for _, mod := range s.ModInfo.ModList {
+			mods = append(mods, mod.ModID+"@"+mod.Version)
+		}
+	}
+
 	return &ServerInfo{
-		Protocol:      res.Version.Protocol,
-		Version:       res.Version.Name,
-		MaxPlayers:    res.Players.Max,
-		OnlinePlayers: res.Players.Online,
-	}, nil
+		Protocol:      s.Version.Protocol,
+		Version:       s.Version.Name,
+		MaxPlayers:    s.Players.Max,
+		OnlinePlayers: s.Players.Online,
+		Players:       players,
+		MOTD:          plainText(chatText(s.Description.RegularChatComponent)),
+		Mods:          mods,
+	}
 }
 
-// Checks if the current timeout duration is zero
-func (p *McPinger) IsTimeoutZero() bool {
-	return p.Timeout == 0
+// Flattens a chat component and its siblings to plain text
+func chatText(c mcpinger.RegularChatComponent) string {
+	var sb strings.Builder
+	sb.WriteString(c.Text)
+	for _, extra := range c.Extra {
+		sb.WriteString(chatText(extra.RegularChatComponent))
+	}
+
+	return sb.String()
+}
+
+// Strips formatting codes and surrounding whitespace
+func plainText(s string) string {
+	return strings.TrimSpace(formattingCodes.ReplaceAllString(s, ""))
 }
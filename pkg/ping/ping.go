@@ -8,6 +8,7 @@ import (
 	sdk "agones.dev/agones/sdks/go"
 
 	"github.com/raefon/agones-mc/internal/config"
+	"github.com/raefon/agones-mc/pkg/metrics"
 )
 
 // Minecraft server pinger and SDK state manager
@@ -16,6 +17,11 @@ type ServerPinger struct {
 	port   uint16
 	sdk    *sdk.SDK
 	pinger Pinger
+	// used instead of pinger until the server is ready
+	readyPinger Pinger
+
+	// called with the info of successful pings
+	observers []func(info *ServerInfo)
 }
 
 type ServerInfo struct {
@@ -23,6 +29,18 @@ type ServerInfo struct {
 	Version       string
 	MaxPlayers    int32
 	OnlinePlayers int32
+	// IDs of a sample of the online players. Only reported by Java servers, which may cap or hide the sample
+	Players []string
+	// Message of the day without formatting codes
+	MOTD string
+	// Only reported by Bedrock servers
+	GameMode  string
+	LevelName string
+	// Mods as modid@version. Only reported by Forge servers
+	Mods []string
+	// Names of all online players and plugins as "name version". Only reported by query pings
+	PlayerNames []string
+	Plugins     []string
 }
 
 // Interface for pinger implementation
@@ -32,6 +50,19 @@ type Pinger interface {
 	IsTimeoutZero() bool
 }
 
+// Implemented by pingers that don't always report the player limit, e.g. RCON pings with commands other than list
+type playerReporter interface {
+	ReportsPlayers() bool
+}
+
+// Checks if the pings of pinger report the server's player limit. Pingers that don't implement ReportsPlayers always do
+func ReportsPlayers(pinger Pinger) bool {
+	if r, ok := pinger.(playerReporter); ok {
+		return r.ReportsPlayers()
+	}
+	return true
+}
+
 const (
 	JavaEdition    string = "java"
 	BedrockEdition string = "bedrock"
@@ -48,9 +79,11 @@ func New(host string, port uint16, edition string) (*ServerPinger, error) {
 	}
 
 	if strings.ToLower(edition) == "bedrock" {
-		return &ServerPinger{host, port, sdk, &BedrockPinger{Port: port, Host: host, Timeout: 0}}, nil
+		pinger := &BedrockPinger{Port: port, Host: host, Timeout: 0}
+		return &ServerPinger{host: host, port: port, sdk: sdk, pinger: pinger, readyPinger: pinger}, nil
 	}
-	return &ServerPinger{host, port, sdk, &McPinger{Port: port, Host: host, Timeout: 0}}, nil
+	pinger := &McPinger{Port: port, Host: host, Timeout: 0}
+	return &ServerPinger{host: host, port: port, sdk: sdk, pinger: pinger, readyPinger: pinger}, nil
 }
 
 // Creates a new AgonesPinger with that will ping the minecraft server at the given host and on the given port.
@@ -65,37 +98,46 @@ func NewTimed(host string, port uint16, timeout time.Duration, edition config.Ed
 	}
 
 	if strings.ToLower(string(edition)) == "bedrock" {
-		return &ServerPinger{host, port, sdk, &BedrockPinger{Port: port, Host: host, Timeout: timeout}}, nil
+		pinger := &BedrockPinger{Port: port, Host: host, Timeout: timeout}
+		return &ServerPinger{host: host, port: port, sdk: sdk, pinger: pinger, readyPinger: pinger}, nil
 	}
-	return &ServerPinger{host, port, sdk, &McPinger{Port: port, Host: host, Timeout: timeout}}, nil
+	pinger := &McPinger{Port: port, Host: host, Timeout: timeout}
+	return &ServerPinger{host: host, port: port, sdk: sdk, pinger: pinger, readyPinger: pinger}, nil
+}
+
+// Creates a new AgonesPinger that checks the server with ready until it is ready and with health afterwards,
+// e.g. with the CompositePingers of NewChecks. Signals the local Agones server through s, so the connection can be
+// shared with other users of the SDK
+func NewChecked(s *sdk.SDK, ready, health Pinger) *ServerPinger {
+	return &ServerPinger{sdk: s, pinger: health, readyPinger: ready}
 }
 
 // Pings the minecraft server and sends Health() signal to the local Agones server on localhost port 9357
 // Returns an error if the ping is unsuccessful
 func (p *ServerPinger) HealthPing() error {
-	_, err := p.pinger.Ping()
+	_, err := p.ping(p.pinger.Ping)
 
 	if err != nil {
 		return err
 	}
 
-	return p.sdk.Health()
+	return p.call("health", p.sdk.Health)
 }
 
 // Pings the minecraft server and sends Ready() signal to the local Agones server on localhost port 9357
 // Returns an error if the ping is unsuccessful
 func (p *ServerPinger) ReadyPing() error {
-	info, err := p.pinger.Ping()
+	info, err := p.ping(p.readyPinger.Ping)
 
 	if err != nil {
 		return err
 	}
 
-	if info.MaxPlayers == 0 {
+	if p.startingUp(info) {
 		return StartingUpErr{}
 	}
 
-	return p.sdk.Ready()
+	return p.call("ready", p.sdk.Ready)
 }
 
 // Pings the minecraft server and sends Health() signal to the local Agones server on localhost port 9357
@@ -105,34 +147,76 @@ func (p *ServerPinger) HealthPingWithTimeout() error {
 		return errors.New("ping timeout is set to 0s")
 	}
 
-	_, err := p.pinger.PingWithTimeout()
+	_, err := p.ping(p.pinger.PingWithTimeout)
 
 	if err != nil {
 		return err
 	}
 
-	err = p.sdk.Health()
-	return err
+	return p.call("health", p.sdk.Health)
 }
 
 // Pings the minecraft server and sends Ready() signal to the local Agones server on localhost port 9357
 // Returns an error if the ping is unsuccessful or timeouts
 func (p *ServerPinger) ReadyPingWithTimeout() error {
-	if p.pinger.IsTimeoutZero() {
+	if p.readyPinger.IsTimeoutZero() {
 		return errors.New("ping timeout is set to 0s")
 	}
 
-	info, err := p.pinger.PingWithTimeout()
+	info, err := p.ping(p.readyPinger.PingWithTimeout)
 
 	if err != nil {
 		return err
 	}
 
-	if info.MaxPlayers == 0 {
+	if p.startingUp(info) {
 		return StartingUpErr{}
 	}
 
-	return p.sdk.Ready()
+	return p.call("ready", p.sdk.Ready)
+}
+
+// Servers report no player limit while starting up. Ready checks that can't report it count the server as started once they pass
+func (p *ServerPinger) startingUp(info *ServerInfo) bool {
+	return info.MaxPlayers == 0 && ReportsPlayers(p.readyPinger)
+}
+
+// Pings the server with ping, recording its latency, player counts and version in the metrics
+func (p *ServerPinger) ping(ping func() (*ServerInfo, error)) (*ServerInfo, error) {
+	start := time.Now()
+	info, err := ping()
+	metrics.ObservePing(time.Since(start), err)
+
+	if err == nil {
+		metrics.ObserveServer(info.OnlinePlayers, info.MaxPlayers, info.Version, info.Protocol)
+		p.notify(info)
+	}
+
+	return info, err
+}
+
+// Registers f to be called with the info of every successful ping of a started server. Pings that don't report the
+// player limit, see ReportsPlayers, are not observed
+func (p *ServerPinger) OnPing(f func(info *ServerInfo)) {
+	p.observers = append(p.observers, f)
+}
+
+func (p *ServerPinger) notify(info *ServerInfo) {
+	// servers report no player limit while starting up
+	if info.MaxPlayers == 0 {
+		return
+	}
+
+	for _, f := range p.observers {
+		f(info)
+	}
+}
+
+// Calls the Agones SDK server, counting the call in the metrics
+func (p *ServerPinger) call(name string, call func() error) error {
+	err := call()
+	metrics.ObserveSDKCall(name, err)
+	return err
 }
 
 // Custom Error for failed pings due to server startup
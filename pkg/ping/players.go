@@ -0,0 +1,175 @@
+package ping
+
+import (
+	"errors"
+	"fmt"
+
+	sdk "agones.dev/agones/sdks/go"
+
+	"github.com/raefon/agones-mc/internal/config"
+)
+
+// Max capacity of an Agones List
+const maxListCapacity = 1000
+
+// Syncs the players reported by pings to Agones
+type PlayerTracker interface {
+	Track(info *ServerInfo) error
+}
+
+// Creates a player tracker for the tracking mode that syncs through the Agones SDK s. Counter tracking sets the count
+// and capacity of counter, and keeps the IDs of connected players in list if it is set. Returns nil if tracking is disabled
+func NewPlayerTracker(s *sdk.SDK, tracking config.PlayerTracking, counter, list string) (PlayerTracker, error) {
+	switch tracking {
+	case config.NoPlayerTracking, "":
+		return nil, nil
+	case config.CounterPlayerTracking, config.AlphaPlayerTracking:
+	default:
+		return nil, fmt.Errorf("unknown player tracking %q. must be none, counters or alpha", tracking)
+	}
+
+	if tracking == config.AlphaPlayerTracking {
+		return &alphaTracker{alpha: s.Alpha()}, nil
+	}
+
+	return &counterTracker{beta: s.Beta(), counter: counter, list: list, count: -1}, nil
+}
+
+// Tracks players with the Counters and Lists API
+type counterTracker struct {
+	beta    *sdk.Beta
+	counter string
+	list    string
+
+	// last synced capacity and count, so unchanged values aren't sent on every ping
+	capacity int32
+	count    int64
+	players  *playerSet
+}
+
+func (t *counterTracker) Track(info *ServerInfo) error {
+	if info.MaxPlayers != t.capacity {
+		if err := t.beta.SetCounterCapacity(t.counter, int64(info.MaxPlayers)); err != nil {
+			return fmt.Errorf("error setting capacity of counter %s: %w", t.counter, err)
+		}
+
+		if t.list != "" {
+			if err := t.beta.SetListCapacity(t.list, int64(min(info.MaxPlayers, maxListCapacity))); err != nil {
+				return fmt.Errorf("error setting capacity of list %s: %w", t.list, err)
+			}
+		}
+
+		t.capacity = info.MaxPlayers
+	}
+
+	if count := int64(info.OnlinePlayers); count != t.count {
+		if err := t.beta.SetCounterCount(t.counter, count); err != nil {
+			return fmt.Errorf("error setting count of counter %s: %w", t.counter, err)
+		}
+		t.count = count
+	}
+
+	if t.list == "" {
+		return nil
+	}
+
+	if t.players == nil {
+		// pick up the players tracked before a restart of the monitor
+		ids, err := t.beta.GetListValues(t.list)
+		if err != nil {
+			return fmt.Errorf("error getting values of list %s: %w", t.list, err)
+		}
+		t.players = newPlayerSet(ids)
+	}
+
+	return t.players.sync(info, func(id string) error {
+		return t.beta.AppendListValue(t.list, id)
+	}, func(id string) error {
+		return t.beta.DeleteListValue(t.list, id)
+	})
+}
+
+// Tracks players with the alpha player tracking API. The player count is the number of connected player IDs, so it is
+// only kept for Java servers
+type alphaTracker struct {
+	alpha *sdk.Alpha
+
+	capacity int32
+	players  *playerSet
+}
+
+func (t *alphaTracker) Track(info *ServerInfo) error {
+	if info.MaxPlayers != t.capacity {
+		if err := t.alpha.SetPlayerCapacity(int64(info.MaxPlayers)); err != nil {
+			return fmt.Errorf("error setting player capacity: %w", err)
+		}
+		t.capacity = info.MaxPlayers
+	}
+
+	if t.players == nil {
+		ids, err := t.alpha.GetConnectedPlayers()
+		if err != nil {
+			return fmt.Errorf("error getting connected players: %w", err)
+		}
+		t.players = newPlayerSet(ids)
+	}
+
+	return t.players.sync(info, func(id string) error {
+		_, err := t.alpha.PlayerConnect(id)
+		return err
+	}, func(id string) error {
+		_, err := t.alpha.PlayerDisconnect(id)
+		return err
+	})
+}
+
+// IDs of the players tracked in Agones
+type playerSet struct {
+	ids map[string]bool
+}
+
+func newPlayerSet(ids []string) *playerSet {
+	s := &playerSet{make(map[string]bool, len(ids))}
+	for _, id := range ids {
+		s.ids[id] = true
+	}
+	return s
+}
+
+// Connects the sampled players that aren't tracked yet. Tracked players missing from the sample are only disconnected
+// when the sample lists every online player, since servers cap the sample (12 players for vanilla)
+func (s *playerSet) sync(info *ServerInfo, connect, disconnect func(id string) error) error {
+	sampled := make(map[string]bool, len(info.Players))
+	var errs []error
+
+	for _, id := range info.Players {
+		sampled[id] = true
+		if s.ids[id] {
+			continue
+		}
+
+		if err := connect(id); err != nil {
+			errs = append(errs, fmt.Errorf("error connecting player %s: %w", id, err))
+			continue
+		}
+		s.ids[id] = true
+	}
+
+	if int32(len(sampled)) < info.OnlinePlayers {
+		return errors.Join(errs...)
+	}
+
+	for id := range s.ids {
+		if sampled[id] {
+			continue
+		}
+
+		if err := disconnect(id); err != nil {
+			errs = append(errs, fmt.Errorf("error disconnecting player %s: %w", id, err))
+			continue
+		}
+		delete(s.ids, id)
+	}
+
+	return errors.Join(errs...)
+}
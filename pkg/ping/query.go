@@ -0,0 +1,172 @@
+package ping
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GameSpy4 query packet types
+const (
+	queryHandshake byte = 0x09
+	queryStat      byte = 0x00
+)
+
+var (
+	queryMagic = []byte{0xFE, 0xFD}
+	// padding between the session ID and the key values of a full stat response
+	queryStatPadding = []byte("splitnum\x00\x80\x00")
+	// padding between the key values and the player names of a full stat response
+	queryPlayersPadding = []byte("\x01player_\x00\x00")
+)
+
+// Max size of a query response
+const maxQueryResponse = 64 * 1024
+
+// Minecraft server pinger using the GameSpy4 query protocol. Needs enable-query=true in server.properties.
+// Reports player names, plugins and the map in addition to the player counts
+type QueryPinger struct {
+	Port    uint16
+	Host    string
+	Timeout time.Duration
+}
+
+// Queries the server's full stat. Returns error on failed query
+func (p *QueryPinger) Ping() (*ServerInfo, error) {
+	return p.query(DefaultTimeout)
+}
+
+// Queries the server's full stat. Returns error on failed query or timeout
+func (p *QueryPinger) PingWithTimeout() (*ServerInfo, error) {
+	return p.query(p.Timeout)
+}
+
+// Checks if the current timeout duration is zero
+func (p *QueryPinger) IsTimeoutZero() bool {
+	return p.Timeout == 0
+}
+
+func (p *QueryPinger) query(timeout time.Duration) (*ServerInfo, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))), timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// session IDs only use the lower 4 bits of each byte
+	session := rand.Uint32() & 0x0F0F0F0F
+
+	res, err := queryRequest(conn, queryHandshake, session, nil)
+	if err != nil {
+		return nil, fmt.Errorf("query handshake failed: %w", err)
+	}
+
+	token, err := strconv.ParseInt(string(bytes.TrimRight(res, "\x00")), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query challenge token: %w", err)
+	}
+
+	// the 4 bytes of padding after the token request the full stat instead of the basic one
+	payload := binary.BigEndian.AppendUint32(nil, uint32(token))
+	payload = append(payload, 0, 0, 0, 0)
+
+	if res, err = queryRequest(conn, queryStat, session, payload); err != nil {
+		return nil, fmt.Errorf("query full stat failed: %w", err)
+	}
+
+	return parseFullStat(res)
+}
+
+// Sends a request and returns the payload of its response
+func queryRequest(conn net.Conn, kind byte, session uint32, payload []byte) ([]byte, error) {
+	req := append(append([]byte{}, queryMagic...), kind)
+	req = binary.BigEndian.AppendUint32(req, session)
+	req = append(req, payload...)
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, maxQueryResponse)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 5 || buf[0] != kind || binary.BigEndian.Uint32(buf[1:5]) != session {
+		return nil, errors.New("unexpected response")
+	}
+
+	return buf[5:n], nil
+}
+
+// Parses the key values and player names of a full stat response
+func parseFullStat(res []byte) (*ServerInfo, error) {
+	res, ok := bytes.CutPrefix(res, queryStatPadding)
+	if !ok {
+		return nil, errors.New("invalid full stat response")
+	}
+
+	kv, players, ok := bytes.Cut(res, queryPlayersPadding)
+	if !ok {
+		return nil, errors.New("invalid full stat response")
+	}
+
+	values := map[string]string{}
+	fields := strings.Split(string(kv), "\x00")
+	for i := 0; i+1 < len(fields) && fields[i] != ""; i += 2 {
+		values[fields[i]] = fields[i+1]
+	}
+
+	online, err := strconv.Atoi(values["numplayers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid player count: %w", err)
+	}
+
+	max, err := strconv.Atoi(values["maxplayers"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid player limit: %w", err)
+	}
+
+	var names []string
+	for _, name := range strings.Split(string(players), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return &ServerInfo{
+		Version:       values["version"],
+		MaxPlayers:    int32(max),
+		OnlinePlayers: int32(online),
+		MOTD:          plainText(values["hostname"]),
+		LevelName:     values["map"],
+		PlayerNames:   names,
+		Plugins:       parsePlugins(values["plugins"]),
+	}, nil
+}
+
+// Parses the plugins of Bukkit servers, e.g. "Paper on Bukkit 1.21.1: WorldEdit 7.3.6; LuckPerms 5.4"
+func parsePlugins(s string) []string {
+	_, list, ok := strings.Cut(s, ": ")
+	if !ok {
+		return nil
+	}
+
+	var plugins []string
+	for _, plugin := range strings.Split(list, "; ") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+
+	return plugins
+}
@@ -0,0 +1,79 @@
+package ping
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/rcon"
+)
+
+// Command of RCON pings that don't set one
+const DefaultRCONCommand = "list"
+
+// Player counts in the list output, e.g. "There are 2 of a max of 20 players online" or "There are 2/20 players online"
+var listPlayers = regexp.MustCompile(`(\d+)(?: of a max of |/)(\d+)`)
+
+// Minecraft server pinger using an RCON command round-trip. Commands run on the server's main thread, so unlike status
+// pings they fail when it is frozen. Player counts are only reported for the list command
+type RCONPinger struct {
+	Port     int
+	Host     string
+	Password string
+	Command  string
+	Timeout  time.Duration
+
+	// kept open between pings. Reconnects after a failed command
+	client *rcon.Client
+}
+
+// Sends the command. Returns error on failed command
+func (p *RCONPinger) Ping() (*ServerInfo, error) {
+	return p.command(DefaultTimeout)
+}
+
+// Sends the command. Returns error on failed command or timeout
+func (p *RCONPinger) PingWithTimeout() (*ServerInfo, error) {
+	return p.command(p.Timeout)
+}
+
+// Checks if the current timeout duration is zero
+func (p *RCONPinger) IsTimeoutZero() bool {
+	return p.Timeout == 0
+}
+
+// Checks if the command is list, the only one whose output has the player counts
+func (p *RCONPinger) ReportsPlayers() bool {
+	fields := strings.Fields(p.Command)
+	return len(fields) == 0 || strings.TrimPrefix(fields[0], "minecraft:") == DefaultRCONCommand
+}
+
+func (p *RCONPinger) command(timeout time.Duration) (*ServerInfo, error) {
+	if p.client == nil {
+		client, err := rcon.Dial(p.Host, p.Port, p.Password)
+		if err != nil {
+			return nil, err
+		}
+		p.client = client
+	}
+
+	cmd := p.Command
+	if cmd == "" {
+		cmd = DefaultRCONCommand
+	}
+
+	res, err := p.client.Command(cmd, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ServerInfo{}
+	if m := listPlayers.FindStringSubmatch(res); m != nil {
+		online, _ := strconv.Atoi(m[1])
+		max, _ := strconv.Atoi(m[2])
+		info.OnlinePlayers, info.MaxPlayers = int32(online), int32(max)
+	}
+
+	return info, nil
+}
@@ -0,0 +1,125 @@
+package rcon
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/james4k/rcon"
+)
+
+// Minecraft server RCON client. Reconnects on the next command after a failed or timed out command
+type Client struct {
+	addr     string
+	password string
+	conn     *rcon.RemoteConsole
+}
+
+// Returned when the server does not respond before the command timeout
+var ErrTimeout = errors.New("rcon: command timed out")
+
+// Connects and authenticates to the RCON server at host:port
+func Dial(host string, port int, password string) (*Client, error) {
+	if password == "" {
+		return nil, errors.New("rcon: password is empty")
+	}
+
+	c := &Client{addr: net.JoinHostPort(host, strconv.Itoa(port)), password: password}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) connect() error {
+	conn, err := rcon.Dial(c.addr, c.password)
+	if err != nil {
+		return err
+	}
+
+	c.conn = conn
+	return nil
+}
+
+// Executes a command and returns the first response. Returns ErrTimeout if no response arrives before timeout
+func (c *Client) Command(cmd string, timeout time.Duration) (string, error) {
+	return c.CommandUntil(cmd, "", timeout)
+}
+
+// Executes a command and reads responses until one contains want. Returns the concatenated responses.
+// Returns ErrTimeout if no matching response arrives before timeout
+func (c *Client) CommandUntil(cmd, want string, timeout time.Duration) (string, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return "", err
+		}
+	}
+
+	reqId, err := c.conn.Write(cmd)
+	if err != nil {
+		c.reset()
+		return "", err
+	}
+
+	type result struct {
+		res string
+		err error
+	}
+
+	done := make(chan result, 1)
+	conn := c.conn
+
+	go func() {
+		var sb strings.Builder
+		for {
+			res, resId, err := conn.Read()
+			if err != nil {
+				done <- result{sb.String(), err}
+				return
+			}
+
+			// skip responses to earlier commands
+			if resId != reqId {
+				continue
+			}
+
+			sb.WriteString(res)
+			if strings.Contains(sb.String(), want) {
+				done <- result{sb.String(), nil}
+				return
+			}
+		}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			c.reset()
+		}
+		return r.res, r.err
+	case <-time.After(timeout):
+		// closing the connection unblocks the reader
+		c.reset()
+		return "", ErrTimeout
+	}
+}
+
+func (c *Client) reset() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
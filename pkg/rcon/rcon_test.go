@@ -0,0 +1,85 @@
+package rcon
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/rcon/rcontest"
+)
+
+func newServer(t *testing.T, handler func(cmd string) []string) *rcontest.Server {
+	t.Helper()
+
+	server, err := rcontest.NewServer("minecraft", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func TestDialWrongPassword(t *testing.T) {
+	server := newServer(t, func(string) []string { return nil })
+
+	if _, err := Dial(server.Host, server.Port, "wrong"); err == nil {
+		t.Error("Dial() with a wrong password succeeded")
+	}
+
+	if _, err := Dial(server.Host, server.Port, ""); err == nil {
+		t.Error("Dial() with an empty password succeeded")
+	}
+}
+
+func TestCommandUntil(t *testing.T) {
+	server := newServer(t, func(cmd string) []string {
+		if cmd == "save-all flush" {
+			// the save completes after a progress message
+			return []string{"Saving the game (this may take a moment!)", "Saved the game"}
+		}
+		return []string{"ok: " + cmd}
+	})
+
+	client, err := Dial(server.Host, server.Port, server.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	res, err := client.Command("save-off", time.Second)
+	if err != nil || res != "ok: save-off" {
+		t.Errorf("Command() = %q, %v", res, err)
+	}
+
+	res, err = client.CommandUntil("save-all flush", "Saved the", time.Second)
+	if err != nil || res != "Saving the game (this may take a moment!)Saved the game" {
+		t.Errorf("CommandUntil() = %q, %v", res, err)
+	}
+}
+
+func TestCommandTimeoutReconnects(t *testing.T) {
+	server := newServer(t, func(cmd string) []string {
+		if cmd == "save-all flush" {
+			return nil
+		}
+		return []string{"ok"}
+	})
+
+	client, err := Dial(server.Host, server.Port, server.Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer client.Close()
+
+	if _, err := client.CommandUntil("save-all flush", "Saved the", 100*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("CommandUntil() error = %v, want ErrTimeout", err)
+	}
+
+	// the next command reconnects
+	if res, err := client.Command("save-on", time.Second); err != nil || res != "ok" {
+		t.Errorf("Command() after timeout = %q, %v", res, err)
+	}
+}
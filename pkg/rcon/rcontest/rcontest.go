@@ -0,0 +1,153 @@
+// Package rcontest provides a fake Minecraft RCON server for tests
+package rcontest
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// Packet types of the RCON protocol
+const (
+	responseValue = 0
+	execCommand   = 2
+	authResponse  = 2
+	auth          = 3
+)
+
+// RCON server on a local port that answers commands with Handler
+type Server struct {
+	Host     string
+	Port     int
+	Password string
+
+	// Returns the responses to a command, each sent as its own packet. No response is sent for nil,
+	// e.g. to test timeouts
+	Handler func(cmd string) []string
+
+	listener net.Listener
+
+	mu       sync.Mutex
+	commands []string
+	conns    []net.Conn
+}
+
+// Starts a server accepting password. The handler is called for every command
+func NewServer(password string, handler func(cmd string) []string) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Host:     "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		Password: password,
+		Handler:  handler,
+		listener: listener,
+	}
+
+	go s.serve()
+	return s, nil
+}
+
+// Returns the address of the server as host:port
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Returns the commands received so far, in order
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Stops the server and closes all connections
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+
+	return err
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		id, typ, body, err := readPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch typ {
+		case auth:
+			// servers send an empty response before the auth response. -1 signals a wrong password
+			writePacket(conn, id, responseValue, "")
+			if body != s.Password {
+				id = -1
+			}
+			writePacket(conn, id, authResponse, "")
+		case execCommand:
+			s.mu.Lock()
+			s.commands = append(s.commands, body)
+			s.mu.Unlock()
+
+			for _, res := range s.Handler(body) {
+				writePacket(conn, id, responseValue, res)
+			}
+		}
+	}
+}
+
+func readPacket(r io.Reader) (id, typ int32, body string, err error) {
+	var size int32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, 0, "", err
+	}
+
+	buf := make([]byte, size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return 0, 0, "", err
+	}
+
+	id = int32(binary.LittleEndian.Uint32(buf[0:4]))
+	typ = int32(binary.LittleEndian.Uint32(buf[4:8]))
+
+	// the body is followed by two null bytes
+	return id, typ, string(buf[8 : len(buf)-2]), nil
+}
+
+func writePacket(w io.Writer, id, typ int32, body string) error {
+	buf := make([]byte, 0, 14+len(body))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(10+len(body)))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(id))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(typ))
+	buf = append(buf, body...)
+	buf = append(buf, 0, 0)
+
+	_, err := w.Write(buf)
+	return err
+}
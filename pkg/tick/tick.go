@@ -0,0 +1,141 @@
+package tick
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/raefon/agones-mc/pkg/rcon"
+)
+
+// Command that is detected from the server's responses
+const AutoCommand = "auto"
+
+// Commands tried in order by AutoCommand: vanilla 1.20.3+, Paper and Spigot, Forge and NeoForge
+var autoCommands = []string{"tick query", "tps", "forge tps", "neoforge tps"}
+
+var (
+	formattingCodes = regexp.MustCompile("§.")
+
+	// tick query, e.g. "Target tick rate: 20.0 per second.Average time per tick: 2.3ms (Target: 50.0ms)"
+	vanillaTarget = regexp.MustCompile(`Target tick rate: ([\d.]+) per second`)
+	vanillaMSPT   = regexp.MustCompile(`Average time per tick: ([\d.]+)ms`)
+
+	// tps, e.g. "TPS from last 1m, 5m, 15m: *20.0, 19.98, 19.95"
+	paperTPS = regexp.MustCompile(`TPS from last 1m, 5m, 15m: \*?([\d.]+)`)
+
+	// forge tps, e.g. "Overall: Mean tick time: 1.234 ms. Mean TPS: 20.000" or "Overall: 20.000 TPS (1.234 ms/tick)"
+	forgeLegacy = regexp.MustCompile(`Overall\s*:\s*Mean tick time:\s*([\d.]+)\s*ms\.\s*Mean TPS:\s*([\d.]+)`)
+	forgeTPS    = regexp.MustCompile(`Overall\s*:\s*([\d.]+)\s*TPS\s*\(([\d.]+)\s*ms/tick\)`)
+)
+
+// Tick rate of a server. Zero values are unknown, e.g. the MSPT reported by Paper's tps command
+type Stats struct {
+	// Ticks per second
+	TPS float64
+	// Milliseconds per tick
+	MSPT float64
+	// Command that reported the stats
+	Command string
+}
+
+// Parses the output of one of the supported commands
+func Parse(output string) (Stats, error) {
+	output = formattingCodes.ReplaceAllString(output, "")
+
+	if m := vanillaMSPT.FindStringSubmatch(output); m != nil {
+		mspt, _ := strconv.ParseFloat(m[1], 64)
+
+		target := 20.0
+		if t := vanillaTarget.FindStringSubmatch(output); t != nil {
+			target, _ = strconv.ParseFloat(t[1], 64)
+		}
+
+		// a server can't tick faster than its target rate, but falls behind once ticks take longer than 1/rate
+		tps := target
+		if mspt > 0 {
+			tps = math.Min(target, 1000/mspt)
+		}
+
+		return Stats{TPS: tps, MSPT: mspt}, nil
+	}
+
+	if m := paperTPS.FindStringSubmatch(output); m != nil {
+		tps, _ := strconv.ParseFloat(m[1], 64)
+		return Stats{TPS: tps}, nil
+	}
+
+	if m := forgeLegacy.FindStringSubmatch(output); m != nil {
+		mspt, _ := strconv.ParseFloat(m[1], 64)
+		tps, _ := strconv.ParseFloat(m[2], 64)
+		return Stats{TPS: tps, MSPT: mspt}, nil
+	}
+
+	if m := forgeTPS.FindStringSubmatch(output); m != nil {
+		tps, _ := strconv.ParseFloat(m[1], 64)
+		mspt, _ := strconv.ParseFloat(m[2], 64)
+		return Stats{TPS: tps, MSPT: mspt}, nil
+	}
+
+	return Stats{}, fmt.Errorf("unrecognized tick rate output: %q", output)
+}
+
+// Queries the tick rate of a server over RCON
+type Querier struct {
+	Host     string
+	Port     int
+	Password string
+	// Command to run, or AutoCommand to use the first supported one
+	Command string
+	Timeout time.Duration
+
+	// kept open between queries. Reconnects after a failed command
+	client *rcon.Client
+	// command detected by AutoCommand
+	detected string
+}
+
+// Runs the tick rate command and parses its output
+func (q *Querier) Query() (Stats, error) {
+	if q.client == nil {
+		client, err := rcon.Dial(q.Host, q.Port, q.Password)
+		if err != nil {
+			return Stats{}, err
+		}
+		q.client = client
+	}
+
+	commands := []string{q.Command}
+	if q.Command == AutoCommand {
+		commands = autoCommands
+		if q.detected != "" {
+			commands = []string{q.detected}
+		}
+	}
+
+	var errs []error
+	for _, cmd := range commands {
+		res, err := q.client.Command(cmd, q.Timeout)
+		if err != nil {
+			return Stats{}, err
+		}
+
+		stats, err := Parse(res)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cmd, err))
+			continue
+		}
+
+		if q.Command == AutoCommand {
+			q.detected = cmd
+		}
+
+		stats.Command = cmd
+		return stats, nil
+	}
+
+	return Stats{}, errors.Join(errs...)
+}
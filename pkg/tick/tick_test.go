@@ -0,0 +1,85 @@
+package tick
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    Stats
+		wantErr bool
+	}{
+		{
+			name:   "tick query",
+			output: "The game is running normally\nTarget tick rate: 20.0 per second.\nAverage time per tick: 2.3ms (Target: 50.0ms)Percentiles: P50: 2.1ms P95: 3.0ms P99: 4.2ms, sample: 100",
+			want:   Stats{TPS: 20, MSPT: 2.3},
+		},
+		{
+			name:   "tick query lagging",
+			output: "The game is running normally\nTarget tick rate: 20.0 per second.\nAverage time per tick: 80.0ms (Target: 50.0ms)Percentiles: P50: 78.2ms P95: 95.1ms P99: 120.4ms, sample: 100",
+			want:   Stats{TPS: 12.5, MSPT: 80},
+		},
+		{
+			name:   "tick query with a custom rate",
+			output: "The game is running normally\nTarget tick rate: 10.0 per second.\nAverage time per tick: 5.0ms (Target: 100.0ms)",
+			want:   Stats{TPS: 10, MSPT: 5},
+		},
+		{
+			name:   "paper tps above 20",
+			output: "§6TPS from last 1m, 5m, 15m: §a*20.0§r§6, §a*20.0§r§6, §a20.0",
+			want:   Stats{TPS: 20},
+		},
+		{
+			name:   "paper tps lagging",
+			output: "§6TPS from last 1m, 5m, 15m: §e17.52§r§6, §a19.6§r§6, §a19.85",
+			want:   Stats{TPS: 17.52},
+		},
+		{
+			name:   "spigot tps",
+			output: "TPS from last 1m, 5m, 15m: 19.98, 19.99, 20.0",
+			want:   Stats{TPS: 19.98},
+		},
+		{
+			name:   "legacy forge tps",
+			output: "Dim  0 (overworld) : Mean tick time: 1.100 ms. Mean TPS: 20.000\nDim -1 (the_nether) : Mean tick time: 0.150 ms. Mean TPS: 20.000\nOverall : Mean tick time: 1.234 ms. Mean TPS: 20.000",
+			want:   Stats{TPS: 20, MSPT: 1.234},
+		},
+		{
+			name:   "forge tps",
+			output: "minecraft:overworld: 18.500 TPS (54.054 ms/tick)\nminecraft:the_nether: 20.000 TPS (0.412 ms/tick)\nOverall: 18.500 TPS (54.466 ms/tick)",
+			want:   Stats{TPS: 18.5, MSPT: 54.466},
+		},
+		{
+			name:   "neoforge tps",
+			output: "minecraft:overworld: 20.000 TPS (1.526 ms/tick)\nminecraft:the_end: 20.000 TPS (0.021 ms/tick)\nOverall: 20.000 TPS (1.547 ms/tick)",
+			want:   Stats{TPS: 20, MSPT: 1.547},
+		},
+		{
+			name:    "unknown command",
+			output:  "Unknown or incomplete command, see below for error§r\ntps<--[HERE]",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.output)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if math.Abs(got.TPS-tt.want.TPS) > 1e-9 || math.Abs(got.MSPT-tt.want.MSPT) > 1e-9 {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}